@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/lukeshay/govite/pkg/engine"
+	"github.com/lukeshay/govite/pkg/node"
 )
 
 func main() {
@@ -30,12 +37,14 @@ func main() {
 	if isDev {
 		log.Info("Starting development engine")
 
+		// Fiber cannot proxy websockets, so ServerPort is not set and the
+		// browser connects the HMR websocket to Vite directly. See the README
+		// for serving everything on a single port with net/http.
 		eng = engine.MustNewDevelopmentEngine(engine.DevelopmentEngineOptions{
-			AppDir:     appDir,
-			Stdout:     os.Stdout,
-			Stderr:     os.Stderr,
-			Logger:     log,
-			ServerPort: 3000,
+			AppDir: appDir,
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+			Logger: log,
 		})
 	} else {
 		log.Info("Starting production engine")
@@ -49,11 +58,17 @@ func main() {
 	}
 	defer eng.Close()
 
+	app.Get("/livez", adaptor.HTTPHandler(engine.LivenessHandler(eng)))
+	app.Get("/readyz", adaptor.HTTPHandler(engine.ReadinessHandler(eng)))
+
 	app.Get("/", func(c *fiber.Ctx) error {
-		result, err := eng.Render(c.Path(), map[string]string{
+		result, err := eng.RenderContext(c.UserContext(), c.Path(), map[string]string{
 			"path": c.Path(),
 			"time": time.Now().Format(time.RFC3339),
 		})
+		if errors.Is(err, node.ErrOverloaded) || errors.Is(err, node.ErrShuttingDown) {
+			return c.SendStatus(fiber.StatusServiceUnavailable)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error rendering: %s\n", err.Error())
 
@@ -66,6 +81,11 @@ func main() {
 	})
 
 	if isDev {
+		// The modules of Vite are served on the same port.
+		app.Use(adaptor.HTTPMiddleware(func(next http.Handler) http.Handler {
+			return engine.DevHandler(eng, next)
+		}))
+
 		app.Get("*", func(c *fiber.Ctx) error {
 			log.Info("Rendering", "path", c.Path())
 
@@ -95,5 +115,23 @@ func main() {
 		})
 	}
 
-	app.Listen(":3000")
+	go func() {
+		if err := app.Listen(":3000"); err != nil {
+			log.Error("Error listening", "error", err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := app.ShutdownWithContext(ctx); err != nil {
+		log.Error("Error shutting down server", "error", err)
+	}
+	if err := eng.Shutdown(ctx); err != nil {
+		log.Error("Error shutting down engine", "error", err)
+	}
 }
@@ -0,0 +1,203 @@
+// Checks runtime.js against the worker vectors in testdata/vectors.json, which
+// conformance_test.go checks the Go implementation against.
+//
+//	node --test internal/protocol/conformance.test.js
+
+import assert from "node:assert/strict"
+import { spawn } from "node:child_process"
+import { readFileSync } from "node:fs"
+import { after, before, test } from "node:test"
+import { fileURLToPath } from "node:url"
+
+const PROTOCOL_VERSION = 1
+const TOKEN = "conformance-token"
+const TIMEOUT = 10_000
+
+/** @param {string} path */
+function read(path) {
+	return readFileSync(fileURLToPath(new URL(path, import.meta.url)), "utf8")
+}
+
+const vectors = JSON.parse(read("testdata/vectors.json"))
+const entry = fileURLToPath(new URL("testdata/entry.mjs", import.meta.url))
+
+// The script the VM runs on node, see node.Script.
+const script =
+	read("../../pkg/utils/nodejs/shim_node.js") +
+	"\n" +
+	read("../../pkg/node/runtime.js")
+
+/**
+ * A node process running runtime.js over stdio, like a worker of the VM.
+ */
+class Worker {
+	constructor() {
+		this.process = spawn(
+			process.execPath,
+			["--no-warnings", "--input-type=module", "-e", script],
+			{
+				env: {
+					...process.env,
+					GOVITE_TRANSPORT: "stdio",
+					GOVITE_WORKER_ID: "conformance",
+					GOVITE_TOKEN: TOKEN,
+					GOVITE_FETCH: "1",
+				},
+				stdio: ["pipe", "pipe", "ignore"],
+			},
+		)
+
+		/** @type {any[]} */
+		this.frames = []
+		/** @type {(() => void) | undefined} */
+		this.notify = undefined
+
+		let buffer = ""
+
+		this.process.stdout.setEncoding("utf8")
+		this.process.stdout.on("data", (data) => {
+			buffer += data
+
+			let index = buffer.indexOf("\n")
+
+			while (index !== -1) {
+				const line = buffer.slice(0, index).trim()
+
+				buffer = buffer.slice(index + 1)
+
+				if (line) {
+					this.frames.push(JSON.parse(line))
+					this.notify?.()
+				}
+
+				index = buffer.indexOf("\n")
+			}
+		})
+	}
+
+	/** @returns {Promise<any>} */
+	async read() {
+		const deadline = Date.now() + TIMEOUT
+
+		while (this.frames.length === 0) {
+			if (Date.now() > deadline) {
+				throw new Error("timed out waiting for a frame")
+			}
+
+			await new Promise((resolve) => {
+				this.notify = resolve
+				setTimeout(resolve, 100)
+			})
+		}
+
+		return this.frames.shift()
+	}
+
+	/**
+	 * @param {string} data
+	 * @param {boolean} [split]
+	 */
+	async write(data, split) {
+		if (!split) {
+			this.process.stdin.write(data)
+			return
+		}
+
+		for (const char of data) {
+			this.process.stdin.write(char)
+			await new Promise((resolve) => setImmediate(resolve))
+		}
+	}
+
+	close() {
+		this.process.stdin.end()
+		this.process.kill()
+	}
+}
+
+/**
+ * Sends the frames of the vector and checks the responses, which may arrive
+ * in any order.
+ *
+ * @param {Worker} worker
+ * @param {{ send: string[], split?: boolean, expect: any[] }} vector
+ */
+async function exchange(worker, vector) {
+	for (const data of vector.send) {
+		await worker.write(data.replaceAll("$ENTRY", entry), vector.split)
+	}
+
+	// Frames are matched by their ID and type, as a request may be answered
+	// by log frames before its result.
+	const pending = new Map(
+		vector.expect.map((expected) => [
+			`${expected.id} ${expected.type}`,
+			expected,
+		]),
+	)
+
+	while (pending.size > 0) {
+		const frame = await worker.read()
+		const key = `${frame.id} ${frame.type}`
+		const expected = pending.get(key)
+
+		assert.ok(
+			expected,
+			`unexpected frame "${frame.id}" of type "${frame.type}"`,
+		)
+
+		pending.delete(key)
+
+		assert.equal(frame.v, PROTOCOL_VERSION)
+
+		if (expected.code) {
+			assert.equal(frame.error?.code, expected.code)
+		}
+
+		if (expected.content !== undefined) {
+			assert.deepEqual(frame.content, expected.content)
+		}
+	}
+}
+
+const worker = new Worker()
+
+after(() => worker.close())
+
+/** @type {any} */
+let hello
+
+before(async () => {
+	hello = await worker.read()
+})
+
+test("hello", () => {
+	assert.equal(hello.type, "hello")
+	assert.deepEqual(hello.content, {
+		versions: [PROTOCOL_VERSION],
+		pid: worker.process.pid,
+		runtime: "node",
+		worker: "conformance",
+		token: TOKEN,
+	})
+})
+
+test("rejects frames before welcome", async () => {
+	await exchange(worker, {
+		send: [`{"v":1,"id":"early","type":"ping"}\n`],
+		expect: [{ id: "early", type: "error", code: "invalid_frame" }],
+	})
+
+	await worker.write(
+		JSON.stringify({
+			v: PROTOCOL_VERSION,
+			id: hello.id,
+			type: "welcome",
+			content: { version: PROTOCOL_VERSION },
+		}) + "\n",
+	)
+})
+
+for (const vector of vectors.worker) {
+	test(vector.name, () => exchange(worker, vector))
+}
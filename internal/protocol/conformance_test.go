@@ -0,0 +1,623 @@
+package protocol_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/lukeshay/govite/internal/protocol"
+	"github.com/lukeshay/govite/pkg/node"
+	"github.com/lukeshay/govite/pkg/utils/nodejs"
+)
+
+// The conformance tests check the Go and Javascript implementations of the VM
+// protocol against the vectors in testdata/vectors.json and the specification
+// in docs/02-vm-protocol.md. conformance.test.js checks runtime.js against the
+// same vectors from Javascript.
+//
+//	go test ./internal/protocol -runtime bun
+
+var (
+	runtimeName = flag.String("runtime", "node", "the Javascript runtime to check: node, bun or deno")
+	timeout     = flag.Duration("timeout", 10*time.Second, "the time to wait for each response of the worker")
+)
+
+const token = "conformance-token"
+
+type vectors struct {
+	Frames []frameVector  `json:"frames"`
+	Worker []workerVector `json:"worker"`
+}
+
+type frameVector struct {
+	Name  string          `json:"name"`
+	Line  string          `json:"line"`
+	Frame json.RawMessage `json:"frame"`
+	Code  string          `json:"code"`
+}
+
+type workerVector struct {
+	Name   string     `json:"name"`
+	Split  bool       `json:"split"`
+	Send   []string   `json:"send"`
+	Expect []expected `json:"expect"`
+}
+
+type expected struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Code    string          `json:"code"`
+	Content json.RawMessage `json:"content"`
+}
+
+func readVectors(t *testing.T) vectors {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "vectors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v vectors
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("could not read vectors: %v", err)
+	}
+
+	return v
+}
+
+// TestConformanceFrames checks that the Go codec decodes every vector and
+// rejects the invalid ones with the right code.
+func TestConformanceFrames(t *testing.T) {
+	for _, vector := range readVectors(t).Frames {
+		t.Run(vector.Name, func(t *testing.T) {
+			frame, err := protocol.NewReader(strings.NewReader(vector.Line + "\n")).ReadFrame()
+
+			if vector.Code != "" {
+				if code := errorCode(err); code != vector.Code {
+					t.Fatalf("expected %s, got %v", vector.Code, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want protocol.Frame
+			if err := json.Unmarshal(vector.Frame, &want); err != nil {
+				t.Fatal(err)
+			}
+
+			compareFrames(t, frame, want)
+
+			var buffer bytes.Buffer
+			if err := protocol.NewWriter(&buffer).WriteFrame(frame); err != nil {
+				t.Fatal(err)
+			}
+
+			roundTrip, err := protocol.NewReader(&buffer).ReadFrame()
+			if err != nil {
+				t.Fatalf("round trip: %v", err)
+			}
+
+			compareFrames(t, roundTrip, want)
+		})
+	}
+}
+
+// TestConformanceStreams checks that the Go codec reads frames regardless of
+// how the stream is chunked and enforces the maximum frame size.
+func TestConformanceStreams(t *testing.T) {
+	var stream bytes.Buffer
+
+	writer := protocol.NewWriter(&stream)
+	big := strings.Repeat("x", 1<<20)
+	contents := []string{"a", big, "b\nc"}
+
+	for i, content := range contents {
+		frame, err := protocol.NewFrame(fmt.Sprint(i), protocol.TypeResult, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := writer.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	encoded := stream.Bytes()
+
+	readAll := func(t *testing.T, r io.Reader) {
+		reader := protocol.NewReader(r)
+
+		for i, content := range contents {
+			frame, err := reader.ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var decoded string
+			if err := frame.Decode(&decoded); err != nil {
+				t.Fatal(err)
+			}
+
+			if frame.ID != fmt.Sprint(i) || decoded != content {
+				t.Fatalf("frame %d does not match", i)
+			}
+		}
+
+		if _, err := reader.ReadFrame(); !errors.Is(err, io.EOF) {
+			t.Fatalf("expected EOF, got %v", err)
+		}
+	}
+
+	t.Run("combined frames", func(t *testing.T) {
+		readAll(t, bytes.NewReader(encoded))
+	})
+
+	t.Run("single bytes", func(t *testing.T) {
+		readAll(t, iotest.OneByteReader(bytes.NewReader(encoded)))
+	})
+
+	t.Run("recovers after invalid frames", func(t *testing.T) {
+		reader := protocol.NewReader(strings.NewReader("garbage\n{\"v\":1,\"id\":\"a\",\"type\":\"ping\"}\n"))
+
+		if _, err := reader.ReadFrame(); !errors.Is(err, protocol.ErrInvalidFrame) {
+			t.Fatalf("expected an invalid frame, got %v", err)
+		}
+
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if frame.ID != "a" {
+			t.Fatalf("expected frame a, got %q", frame.ID)
+		}
+	})
+
+	t.Run("frame too large", func(t *testing.T) {
+		reader := protocol.NewReader(bytes.NewReader(encoded))
+		reader.MaxFrameSize = 1 << 10
+
+		if _, err := reader.ReadFrame(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := reader.ReadFrame(); !errors.Is(err, protocol.ErrFrameTooLarge) {
+			t.Fatalf("expected %v, got %v", protocol.ErrFrameTooLarge, err)
+		}
+	})
+}
+
+// worker is a runtime process speaking the protocol over stdio.
+type worker struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	writer *protocol.Writer
+	frames chan protocol.Frame
+	errs   chan error
+}
+
+func startWorker(t *testing.T, runtime nodejs.Runtime, dir string) *worker {
+	t.Helper()
+
+	cmd := nodejs.NewNodeJSCommand(nodejs.NodeJSCommandOptions{
+		Runtime: runtime,
+		Script:  node.Script(runtime),
+		Dir:     dir,
+		Stderr:  io.Discard,
+		Env: map[string]string{
+			"GOVITE_TRANSPORT": "stdio",
+			"GOVITE_WORKER_ID": "conformance",
+			"GOVITE_TOKEN":     token,
+			"GOVITE_FETCH":     "1",
+		},
+	})
+
+	cmd.Stdout = nil
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &worker{
+		cmd:    cmd,
+		stdin:  stdin,
+		writer: protocol.NewWriter(stdin),
+		frames: make(chan protocol.Frame, 16),
+		errs:   make(chan error, 16),
+	}
+
+	t.Cleanup(func() {
+		stdin.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	go func() {
+		reader := protocol.NewReader(stdout)
+
+		for {
+			frame, err := reader.ReadFrame()
+
+			switch {
+			case err == nil:
+				w.frames <- frame
+			case errors.Is(err, protocol.ErrInvalidFrame):
+				w.errs <- err
+			default:
+				w.errs <- err
+				return
+			}
+		}
+	}()
+
+	return w
+}
+
+func (w *worker) Read(t *testing.T) protocol.Frame {
+	t.Helper()
+
+	select {
+	case frame := <-w.frames:
+		return frame
+	case err := <-w.errs:
+		t.Fatalf("could not read frame: %v", err)
+	case <-time.After(*timeout):
+		t.Fatal("timed out waiting for a frame")
+	}
+
+	return protocol.Frame{}
+}
+
+func (w *worker) Write(t *testing.T, data string, split bool) {
+	t.Helper()
+
+	if !split {
+		if _, err := io.WriteString(w.stdin, data); err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	for i := range len(data) {
+		if _, err := io.WriteString(w.stdin, data[i:i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (w *worker) WriteFrame(t *testing.T, id string, frameType string, content any) {
+	t.Helper()
+
+	frame, err := protocol.NewFrame(id, frameType, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.writer.WriteFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestConformanceWorker runs a real worker through the handshake and every
+// worker vector. The subtests share the worker and run in order.
+func TestConformanceWorker(t *testing.T) {
+	runtime, ok := map[string]nodejs.Runtime{
+		"node": nodejs.Node,
+		"bun":  nodejs.Bun,
+		"deno": nodejs.Deno,
+	}[*runtimeName]
+	if !ok {
+		t.Fatalf("unknown runtime %q", *runtimeName)
+	}
+
+	if testing.Short() {
+		t.Skip("skipping worker in short mode")
+	}
+	if _, err := exec.LookPath(runtime.Name()); err != nil {
+		t.Skipf("%s is not installed: %v", runtime.Name(), err)
+	}
+
+	entry, err := filepath.Abs(filepath.Join("testdata", "entry.mjs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry = filepath.ToSlash(entry)
+
+	w := startWorker(t, runtime, t.TempDir())
+
+	hello := w.Read(t)
+
+	t.Run("hello", func(t *testing.T) {
+		var content struct {
+			Versions []int  `json:"versions"`
+			PID      int    `json:"pid"`
+			Worker   string `json:"worker"`
+			Token    string `json:"token"`
+		}
+
+		if err := hello.Decode(&content); err != nil {
+			t.Fatal(err)
+		}
+
+		switch {
+		case hello.Type != protocol.TypeHello:
+			t.Fatalf("expected hello, got %q", hello.Type)
+		case !reflect.DeepEqual(content.Versions, []int{protocol.Version}):
+			t.Fatalf("expected versions [%d], got %v", protocol.Version, content.Versions)
+		case content.PID != w.cmd.Process.Pid:
+			t.Fatalf("expected pid %d, got %d", w.cmd.Process.Pid, content.PID)
+		case content.Worker != "conformance" || content.Token != token:
+			t.Fatalf("unexpected worker %q or token %q", content.Worker, content.Token)
+		}
+	})
+
+	if hello.Type != protocol.TypeHello {
+		t.Fatal("worker did not send hello")
+	}
+
+	t.Run("rejects frames before welcome", func(t *testing.T) {
+		exchange(t, w, workerVector{
+			Send:   []string{"{\"v\":1,\"id\":\"early\",\"type\":\"ping\"}\n"},
+			Expect: []expected{{ID: "early", Type: protocol.TypeError, Code: protocol.CodeInvalidFrame}},
+		})
+	})
+
+	w.WriteFrame(t, hello.ID, protocol.TypeWelcome, map[string]int{"version": protocol.Version})
+
+	for _, vector := range readVectors(t).Worker {
+		for i := range vector.Send {
+			vector.Send[i] = strings.ReplaceAll(vector.Send[i], "$ENTRY", entry)
+		}
+
+		t.Run(vector.Name, func(t *testing.T) {
+			exchange(t, w, vector)
+		})
+	}
+
+	t.Run("traced render", func(t *testing.T) {
+		frame, err := protocol.NewFrame("traced", protocol.TypeRender, map[string]any{
+			"entry": entry,
+			"url":   "/traced",
+			"props": map[string]string{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		frame.Traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+		if err := w.writer.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+
+		result := w.Read(t)
+
+		names := map[string]bool{}
+
+		for _, span := range result.Spans {
+			if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentSpanID != "00f067aa0ba902b7" {
+				t.Errorf("span %q is not a child of the traceparent", span.Name)
+			}
+
+			if span.End < span.Start {
+				t.Errorf("span %q ends before it starts", span.Name)
+			}
+
+			names[span.Name] = true
+		}
+
+		if !names["import"] || !names["render"] {
+			t.Fatalf("expected import and render spans, got %+v", result.Spans)
+		}
+	})
+
+	t.Run("govite.call", func(t *testing.T) {
+		w.WriteFrame(t, "calling", protocol.TypeRender, map[string]any{
+			"entry": entry,
+			"url":   "/call",
+			"props": map[string]int{"id": 1},
+		})
+
+		invoke := w.Read(t)
+
+		if invoke.Type != protocol.TypeInvoke || invoke.ID == "" {
+			t.Fatalf("expected an invoke frame, got %q of type %q", invoke.ID, invoke.Type)
+		}
+
+		compareJSON(t, invoke.Content, json.RawMessage(`{"request":"calling","name":"getUser","args":{"id":1}}`))
+
+		w.WriteFrame(t, invoke.ID, protocol.TypeResult, map[string]string{"name": "gopher"})
+
+		exchange(t, w, workerVector{
+			Expect: []expected{{
+				ID:      "calling",
+				Type:    protocol.TypeResult,
+				Content: json.RawMessage(`{"user":{"name":"gopher"}}`),
+			}},
+		})
+	})
+
+	t.Run("fetch bridge", func(t *testing.T) {
+		w.WriteFrame(t, "fetching", protocol.TypeRender, map[string]any{
+			"entry":  entry,
+			"url":    "/fetch",
+			"props":  map[string]string{},
+			"origin": "https://example.com",
+		})
+
+		fetch := w.Read(t)
+
+		var content struct {
+			Request string `json:"request"`
+			Method  string `json:"method"`
+			URL     string `json:"url"`
+			Body    []byte `json:"body"`
+		}
+
+		if err := fetch.Decode(&content); err != nil {
+			t.Fatal(err)
+		}
+
+		switch {
+		case fetch.Type != protocol.TypeFetch:
+			t.Fatalf("expected a fetch frame, got %q of type %q", fetch.ID, fetch.Type)
+		case content.Request != "fetching" || content.Method != "POST" || string(content.Body) != "hi":
+			t.Fatalf("unexpected fetch %+v", content)
+		case content.URL != "https://example.com/api/user?id=1":
+			t.Fatalf("expected the URL to be resolved against the origin, got %q", content.URL)
+		}
+
+		w.WriteFrame(t, fetch.ID, protocol.TypeResult, map[string]any{
+			"status":  201,
+			"headers": [][2]string{{"Content-Type", "text/plain"}},
+			"body":    []byte("created"),
+		})
+
+		exchange(t, w, workerVector{
+			Expect: []expected{{
+				ID:      "fetching",
+				Type:    protocol.TypeResult,
+				Content: json.RawMessage(`{"status":201,"text":"created"}`),
+			}},
+		})
+	})
+
+	t.Run("large render", func(t *testing.T) {
+		big := strings.Repeat("x", 8<<20)
+
+		w.WriteFrame(t, "large", protocol.TypeRender, map[string]any{
+			"entry": entry,
+			"url":   "/large",
+			"props": map[string]string{"big": big},
+		})
+
+		result := w.Read(t)
+
+		var content struct {
+			Props struct {
+				Big string `json:"big"`
+			} `json:"props"`
+		}
+
+		if err := result.Decode(&content); err != nil {
+			t.Fatal(err)
+		}
+
+		if result.ID != "large" || content.Props.Big != big {
+			t.Fatal("large render did not round trip")
+		}
+	})
+}
+
+// exchange sends the frames of the vector and checks the responses, which may
+// arrive in any order.
+func exchange(t *testing.T, w *worker, vector workerVector) {
+	t.Helper()
+
+	for _, data := range vector.Send {
+		w.Write(t, data, vector.Split)
+	}
+
+	// Frames are matched by their ID and type, as a request may be answered
+	// by log frames before its result.
+	pending := map[string]expected{}
+	for _, e := range vector.Expect {
+		pending[e.ID+" "+e.Type] = e
+	}
+
+	for len(pending) > 0 {
+		frame := w.Read(t)
+
+		want, ok := pending[frame.ID+" "+frame.Type]
+		if !ok {
+			t.Fatalf("unexpected frame %q of type %q", frame.ID, frame.Type)
+		}
+
+		delete(pending, frame.ID+" "+frame.Type)
+
+		if want.Code != "" && (frame.Error == nil || frame.Error.Code != want.Code) {
+			t.Fatalf("frame %q: expected code %q, got %+v", frame.ID, want.Code, frame.Error)
+		}
+
+		if want.Content != nil {
+			compareJSON(t, frame.Content, want.Content)
+		}
+	}
+}
+
+func compareFrames(t *testing.T, got, want protocol.Frame) {
+	t.Helper()
+
+	if got.Version != want.Version || got.ID != want.ID || got.Type != want.Type || got.Heap != want.Heap {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	if !reflect.DeepEqual(got.Error, want.Error) {
+		t.Fatalf("expected error %+v, got %+v", want.Error, got.Error)
+	}
+
+	if len(got.Content) == 0 && len(want.Content) == 0 {
+		return
+	}
+
+	compareJSON(t, got.Content, want.Content)
+}
+
+func compareJSON(t *testing.T, got, want json.RawMessage) {
+	t.Helper()
+
+	var gotValue, wantValue any
+
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(want, &wantValue); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Fatalf("expected content %s, got %s", want, got)
+	}
+}
+
+func errorCode(err error) string {
+	var protocolErr *protocol.Error
+
+	switch {
+	case errors.As(err, &protocolErr):
+		return protocolErr.Code
+	case errors.Is(err, protocol.ErrInvalidFrame):
+		return protocol.CodeInvalidFrame
+	default:
+		return ""
+	}
+}
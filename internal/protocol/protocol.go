@@ -0,0 +1,270 @@
+// Package protocol implements version 1 of the wire protocol spoken between
+// the VM and its workers. See docs/02-vm-protocol.md for the specification.
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Version is the version of the protocol implemented by this package.
+const Version = 1
+
+// DefaultMaxFrameSize is the default maximum size of a single frame.
+const DefaultMaxFrameSize = 64 << 20
+
+// Frame types sent by the VM.
+const (
+	TypeWelcome = "welcome"
+	TypePing    = "ping"
+	TypeImport  = "import"
+	TypeRender  = "render"
+	TypeLoad    = "load"
+	TypeCall    = "call"
+	TypeEval    = "eval"
+)
+
+// Frame types sent by workers.
+const (
+	TypeHello  = "hello"
+	TypeResult = "result"
+	TypeError  = "error"
+	TypeLog    = "log"
+	TypeInvoke = "invoke"
+	TypeFetch  = "fetch"
+)
+
+// Error codes of error frames.
+const (
+	CodeInvalidFrame       = "invalid_frame"
+	CodeUnsupportedVersion = "unsupported_version"
+	CodeUnknownType        = "unknown_type"
+	CodeUnauthenticated    = "unauthenticated"
+	CodeException          = "exception"
+	CodeUnknownFunc        = "unknown_func"
+)
+
+var (
+	// ErrFrameTooLarge is returned when a frame exceeds the maximum size.
+	ErrFrameTooLarge = errors.New("frame too large")
+	// ErrInvalidFrame is matched by the errors returned for frames that are
+	// not valid JSON or miss one of the required fields.
+	ErrInvalidFrame = errors.New("invalid frame")
+)
+
+// Frame is a single message of the protocol. Every frame is encoded as a
+// single line of JSON terminated by "\n".
+type Frame struct {
+	// Version is the protocol version the frame was encoded with.
+	Version int `json:"v"`
+	// ID identifies a request. Responses have the ID of their request.
+	ID string `json:"id"`
+	// Type is the type of the frame.
+	Type string `json:"type"`
+	// Content is the payload of the frame. Its shape depends on Type.
+	Content json.RawMessage `json:"content,omitempty"`
+	// Error is set for frames of the "error" type.
+	Error *Error `json:"error,omitempty"`
+	// Heap is the heap size in bytes of the worker after it handled the
+	// request.
+	Heap int64 `json:"heap,omitempty"`
+	// Traceparent is the W3C traceparent of the span a request is part of.
+	// Workers only record spans for requests that have one.
+	Traceparent string `json:"traceparent,omitempty"`
+	// Spans are the spans a worker recorded while handling the request.
+	Spans []Span `json:"spans,omitempty"`
+}
+
+// NewFrame returns a frame of the current version with the content encoded
+// as JSON.
+func NewFrame(id string, frameType string, content any) (Frame, error) {
+	frame := Frame{
+		Version: Version,
+		ID:      id,
+		Type:    frameType,
+	}
+
+	if content != nil {
+		marshalled, err := json.Marshal(content)
+		if err != nil {
+			return Frame{}, err
+		}
+
+		frame.Content = marshalled
+	}
+
+	return frame, nil
+}
+
+// NewErrorFrame returns an error frame of the current version.
+func NewErrorFrame(id string, err *Error) Frame {
+	return Frame{
+		Version: Version,
+		ID:      id,
+		Type:    TypeError,
+		Error:   err,
+	}
+}
+
+// Decode decodes the content of the frame into v.
+func (f Frame) Decode(v any) error {
+	if len(f.Content) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(f.Content, v)
+}
+
+// Validate checks that the frame has every required field and a supported
+// version. Only error frames answering a line that could not be parsed and
+// log frames that are not part of a request may have an empty ID.
+func (f Frame) Validate() error {
+	switch {
+	case f.Version != Version:
+		return &Error{Code: CodeUnsupportedVersion, Message: fmt.Sprintf("unsupported protocol version %d", f.Version)}
+	case f.ID == "" && f.Type != TypeError && f.Type != TypeLog:
+		return &Error{Code: CodeInvalidFrame, Message: "frame is missing an id"}
+	case f.Type == "":
+		return &Error{Code: CodeInvalidFrame, Message: "frame is missing a type"}
+	case f.Type == TypeError && f.Error == nil:
+		return &Error{Code: CodeInvalidFrame, Message: "error frame is missing an error"}
+	}
+
+	return nil
+}
+
+// Error is the structured error of an error frame.
+type Error struct {
+	// Code classifies the error. See the Code constants.
+	Code string `json:"code"`
+	// Name is the name of the Javascript error, i.e. "TypeError".
+	Name string `json:"name,omitempty"`
+	// Message is the message of the error.
+	Message string `json:"message"`
+	// Stack is the Javascript stack trace of the error, if any.
+	Stack string `json:"stack,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("%s: %s", e.Name, e.Message)
+	}
+
+	return e.Message
+}
+
+// Span is a span recorded by a worker. Its IDs are the lowercase hex
+// encoding of the W3C trace context IDs.
+type Span struct {
+	// TraceID is the ID of the trace of the request.
+	TraceID string `json:"traceId"`
+	// SpanID is the ID of the span.
+	SpanID string `json:"spanId"`
+	// ParentSpanID is the ID of the parent span. It is the span of the
+	// traceparent for the outermost spans of a request.
+	ParentSpanID string `json:"parentSpanId"`
+	// Name is the name of the span, i.e. "render".
+	Name string `json:"name"`
+	// Start is the time the span started in milliseconds since the Unix
+	// epoch.
+	Start float64 `json:"start"`
+	// End is the time the span ended in milliseconds since the Unix epoch.
+	End float64 `json:"end"`
+	// Attributes are the attributes of the span.
+	Attributes map[string]any `json:"attributes,omitempty"`
+	// Error is the message of the error the span failed with, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// Reader reads frames from a stream. It keeps bytes that were read ahead, so a
+// single Reader must be used for the lifetime of the stream.
+type Reader struct {
+	reader       *bufio.Reader
+	MaxFrameSize int
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		reader:       bufio.NewReaderSize(r, 64<<10),
+		MaxFrameSize: DefaultMaxFrameSize,
+	}
+}
+
+// ReadFrame reads the next frame. Frames that cannot be decoded return an
+// error matching ErrInvalidFrame and the stream can still be read afterwards.
+func (r *Reader) ReadFrame() (Frame, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return Frame{}, err
+	}
+
+	var frame Frame
+	if err := json.Unmarshal(line, &frame); err != nil {
+		return Frame{}, fmt.Errorf("%w: %w", ErrInvalidFrame, err)
+	}
+
+	if err := frame.Validate(); err != nil {
+		return frame, fmt.Errorf("%w: %w", ErrInvalidFrame, err)
+	}
+
+	return frame, nil
+}
+
+func (r *Reader) readLine() ([]byte, error) {
+	var line []byte
+
+	for {
+		chunk, err := r.reader.ReadSlice('\n')
+		line = append(line, chunk...)
+
+		if len(line) > r.MaxFrameSize {
+			return nil, ErrFrameTooLarge
+		}
+
+		switch {
+		case err == nil:
+			line = bytes.TrimSuffix(line[:len(line)-1], []byte("\r"))
+			if len(line) == 0 {
+				continue
+			}
+
+			return line, nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		default:
+			return nil, err
+		}
+	}
+}
+
+// Writer writes frames to a stream. It is safe for concurrent use.
+type Writer struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{writer: w}
+}
+
+// WriteFrame writes the frame followed by a newline in a single write.
+func (w *Writer) WriteFrame(frame Frame) error {
+	marshalled, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	_, err = w.writer.Write(append(marshalled, '\n'))
+
+	return err
+}
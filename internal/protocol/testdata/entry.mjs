@@ -0,0 +1,14 @@
+export async function render(props, url) {
+	if (url === "/throw") throw new TypeError("boom")
+	if (url === "/call") return { user: await govite.call("getUser", props) }
+	if (url === "/fetch") {
+		const response = await fetch("/api/user?id=1", { method: "POST", body: "hi" })
+		return { status: response.status, text: await response.text() }
+	}
+	if (url === "/log") console.warn("hello %s", "world", { a: 1 })
+	return { url, props }
+}
+
+export async function add(a, b) {
+	return a + b
+}
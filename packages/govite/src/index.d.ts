@@ -8,9 +8,40 @@ declare global {
 	interface Window {
 		__INITIAL_STATE__: any
 	}
+
+	interface WindowEventMap {
+		/**
+		 * Dispatched in development when the props of the page changed after
+		 * DevelopmentEngine.Refresh. The page reloads unless a listener calls
+		 * preventDefault.
+		 */
+		"govite:props": CustomEvent<any>
+	}
+
+	/** Provided by govite while rendering on the server. */
+	var govite: {
+		/**
+		 * Calls the Go function registered under name with RegisterFunc. The Go
+		 * function gets the context of the render the call is made in.
+		 */
+		call<Result = any>(name: string, args?: any): Promise<Result>
+	}
+}
+
+/** A page routed from src/pages. */
+export type Page = {
+	/** The name of the page, i.e. "users/[id]" for src/pages/users/[id].tsx. */
+	name: string
+	/** The values of the dynamic segments of the page. */
+	params: Record<string, string>
 }
 
-export type RenderHandler = (props: any) => Promise<RenderResult> | RenderResult
+export type RenderHandler = (
+	props: any,
+	url: string,
+	/** The page being rendered, only given for pages routed from src/pages. */
+	page?: Page,
+) => Promise<RenderResult> | RenderResult
 
 /**
  * Retrieves the client side props from the window object.
@@ -1,4 +1,7 @@
 import * as fs from "node:fs/promises"
+import { AsyncLocalStorage } from "node:async_hooks"
+import { Buffer } from "node:buffer"
+import { timingSafeEqual } from "node:crypto"
 import { createServer } from "vite"
 import express from "express"
 import { cwd } from "node:process"
@@ -8,98 +11,358 @@ const port = Number(process.env["PORT"] || 6543)
 const hmrPort = Number(process.env["HMR_PORT"] || 26543)
 const base = process.env["BASE"] || "/"
 const serverPort = Number(process.env["SERVER_PORT"])
+// The endpoint of the Go process, used to call the functions it registered.
+const loopback = process.env["GOVITE_LOOPBACK"]
+const token = process.env["GOVITE_TOKEN"]
+
+delete process.env["GOVITE_TOKEN"]
+
+// The Go process holds stdin open until it exits, even when it is killed, so
+// the dev server never outlives it.
+if (loopback) {
+	process.stdin.on("end", () => process.exit())
+	process.stdin.on("error", () => process.exit())
+	process.stdin.resume()
+}
+
+/**
+ * Loaded by every page rendered in development. On a refresh event the props
+ * of the page are fetched as JSON again, and when they changed a cancelable
+ * "govite:props" event is dispatched on window with them. The page is
+ * reloaded unless a listener calls preventDefault.
+ *
+ * Pages reload when the Go process restarted, as the dev server exits with it
+ * and the Vite client reloads once the HMR websocket reconnects to the dev
+ * server of the new process, which keeps its ports.
+ */
+const reloadScript = `
+import { createHotContext } from "${base}@vite/client"
+
+const hot = createHotContext("/__govite/reload")
+
+async function refresh() {
+	try {
+		const response = await fetch(location.href, {
+			headers: { accept: "application/json" },
+		})
+		const type = response.headers.get("content-type") ?? ""
+
+		if (!response.ok || !type.includes("application/json")) {
+			throw new Error(response.statusText)
+		}
+
+		const props = await response.json()
+
+		if (JSON.stringify(props) === JSON.stringify(window.__INITIAL_STATE__)) {
+			return
+		}
+
+		window.__INITIAL_STATE__ = props
+
+		const event = new CustomEvent("govite:props", {
+			detail: props,
+			cancelable: true,
+		})
+
+		if (window.dispatchEvent(event)) {
+			location.reload()
+		}
+	} catch {
+		location.reload()
+	}
+}
+
+hot.on("govite:refresh", () => refresh())
+`
+
+/**
+ * The ID and origin of the render being handled, given by the Go process.
+ *
+ * @type {AsyncLocalStorage<{ id: string, origin: string }>}
+ */
+const requests = new AsyncLocalStorage()
+
+// The fetch of the runtime, which is wrapped below to serve same-origin
+// fetches with the handler of the Go process.
+const nativeFetch = globalThis.fetch
+
+/**
+ * Posts the content to the endpoint of the Go process.
+ *
+ * @param {string} path
+ * @param {any} content
+ * @returns {Promise<Response>}
+ */
+async function post(path, content) {
+	const response = await nativeFetch(`${loopback}${path}`, {
+		method: "POST",
+		headers: {
+			authorization: `Bearer ${token}`,
+			"content-type": "application/json",
+		},
+		body: JSON.stringify(content),
+	})
+
+	if (!response.ok) {
+		throw new Error(`govite: ${response.status} ${await response.text()}`)
+	}
+
+	return response
+}
+
+/**
+ * Rejects the requests that do not carry the token of the Go process, as only
+ * it may render pages and send events to them.
+ *
+ * @param {import("express").Request} req
+ * @param {import("express").Response} res
+ * @param {import("express").NextFunction} next
+ */
+function authenticate(req, res, next) {
+	const expected = Buffer.from(`Bearer ${token}`)
+	const actual = Buffer.from(req.headers.authorization ?? "")
+
+	if (
+		!token ||
+		actual.length !== expected.length ||
+		!timingSafeEqual(actual, expected)
+	) {
+		res.status(401).end("unauthenticated")
+		return
+	}
+
+	next()
+}
+
+/**
+ * Tells the Go process that the dev server is ready or failed to start, in
+ * which case the process exits.
+ *
+ * @param {any} [error]
+ */
+async function ready(error) {
+	if (!loopback) {
+		if (error) {
+			throw error
+		}
+
+		return
+	}
+
+	await post("/ready", error ? { error: error.stack ?? String(error) } : {})
+
+	if (error) {
+		process.exit(1)
+	}
+}
+
+/**
+ * Calls the Go function registered under name with RegisterFunc.
+ *
+ * @param {string} name
+ * @param {any} [args]
+ * @returns {Promise<any>}
+ */
+async function call(name, args) {
+	const response = await post("/invoke", {
+		request: requests.getStore()?.id ?? "",
+		name,
+		args,
+	})
+
+	const { content, error } = await response.json()
+
+	if (error) {
+		throw Object.assign(new Error(error.message), { code: error.code })
+	}
+
+	return content
+}
+
+// @ts-ignore
+globalThis.govite = { ...globalThis.govite, call }
+
+// Statuses of responses that must not have a body.
+const NULL_BODY_STATUSES = [101, 204, 205, 304]
+
+// Relative and same-origin fetches are served by the handler of the Go
+// process, if it has one, instead of going over the network.
+if (process.env["GOVITE_FETCH"] === "1") {
+	globalThis.fetch = async function (input, init) {
+		const context = requests.getStore()
+
+		if (!context) {
+			return nativeFetch(input, init)
+		}
+
+		if (typeof input === "string" || input instanceof URL) {
+			input = new URL(input, context.origin)
+		}
+
+		const request = new Request(input, init)
+
+		if (new URL(request.url).origin !== context.origin) {
+			return nativeFetch(request)
+		}
+
+		/** @type {{ status: number, headers?: [string, string][], body?: string }} */
+		let served
+
+		try {
+			const response = await post("/fetch", {
+				request: context.id,
+				method: request.method,
+				url: request.url,
+				headers: [...request.headers],
+				body: request.body
+					? Buffer.from(await request.arrayBuffer()).toString("base64")
+					: undefined,
+			})
+
+			served = await response.json()
+		} catch (error) {
+			throw new TypeError("fetch failed", { cause: error })
+		}
+
+		const body =
+			served.body && !NULL_BODY_STATUSES.includes(served.status)
+				? Buffer.from(served.body, "base64")
+				: null
+
+		return new Response(body, {
+			status: served.status,
+			headers: served.headers ?? [],
+		})
+	}
+}
 
 // Create http server
 const app = express()
 
-const vite = await createServer({
-	appType: "custom",
-	base,
-	root: cwd(),
-	server: {
-		middlewareMode: true,
-		hmr: {
-			port: hmrPort,
+/** @type {import("vite").ViteDevServer} */
+let vite
+/** @type {string} */
+let htmlTemplate
+
+try {
+	vite = await createServer({
+		appType: "custom",
+		base,
+		root: cwd(),
+		server: {
+			middlewareMode: true,
+			hmr: {
+				port: hmrPort,
+				// The Go server proxies the HMR websocket when its port is known.
+				clientPort: serverPort || hmrPort,
+			},
+			port: serverPort,
 		},
-		port: serverPort,
-	},
-})
+	})
 
-app.use(vite.middlewares)
+	htmlTemplate = await fs.readFile("./index.html", "utf-8")
+} catch (error) {
+	await ready(error)
+}
 
-const htmlTemplate = await fs.readFile("./index.html", "utf-8")
+/**
+ * A render requested by the Go process.
+ *
+ * @typedef {object} RenderRequest
+ * @property {string} url The path being rendered.
+ * @property {any} props
+ * @property {string} request The ID of the render.
+ * @property {string} origin The origin of the request being rendered.
+ * @property {{ name: string, params: Record<string, string> }} [page]
+ * @property {Record<string, any>} [defines]
+ */
 
-// Serve HTML
-app.use("*", async (req, res) => {
-	console.log(
-		"Request",
-		req.url,
-		req.headers.host,
-		req.headers.origin,
-		req.headers.referer,
-		req.headers["user-agent"],
-	)
+// Render the page in the body of the request. Props are sent in the body, so
+// they are not limited by the length of a URL.
+app.post(
+	"/__govite/render",
+	authenticate,
+	express.json({ limit: "64mb" }),
+	async (req, res) => {
+		/** @type {RenderRequest} */
+		const { url: path, props, request, origin, page, defines } = req.body
 
-	try {
-		const url = new URL(req.url ?? "", `http://${req.headers.host}`)
-
-		const propsParam = url.searchParams.get("props")
-		const props = propsParam ? JSON.parse(decodeURIComponent(propsParam)) : {}
-		const definesParam = url.searchParams.get("defines")
-		const defines = definesParam
-			? JSON.parse(decodeURIComponent(definesParam))
-			: {}
-		console.log("propsParam", propsParam, "definesParam", definesParam)
-
-		const template = await vite.transformIndexHtml(
-			url.pathname.replace(base, ""),
-			htmlTemplate,
-		)
-		const { render } = await vite.ssrLoadModule("/src/entry-server")
-
-		const rendered = await render(props)
-
-		const html = template
-			.replace("</head>", `${rendered.head ?? ""}</head>`)
-			.replace(
-				"</head>",
-				rendered.css ? `<style>${rendered.css}</style>\n</head>` : "</head>",
+		try {
+			const url = new URL(path, origin)
+
+			const template = await vite.transformIndexHtml(
+				url.pathname.replace(base, ""),
+				htmlTemplate,
+			)
+			const { render } = await vite.ssrLoadModule("/src/entry-server")
+
+			const rendered = await requests.run({ id: request, origin }, () =>
+				page
+					? render(props, url.pathname, page)
+					: render(props, url.pathname),
 			)
-			.replace(
-				"</head>",
-				`<script>
+
+			const html = template
+				.replace("</head>", `${rendered.head ?? ""}</head>`)
+				.replace(
+					"</head>",
+					rendered.css
+						? `<style>${rendered.css}</style>\n</head>`
+						: "</head>",
+				)
+				.replace(
+					"</head>",
+					`<script>
           window.__INITIAL_STATE__ = ${JSON.stringify(props)};
-          window.__DEFINES__ = ${JSON.stringify(defines)};
+          window.__DEFINES__ = ${JSON.stringify(defines ?? {})};
           window.__HMR_CONFIG_NAME__ = undefined;
           window.__BASE__ = "${base}";
           window.__SERVER_HOST__ = window.location.origin;
           window.__HMR_PROTOCOL__ = "ws";
-          window.__HMR_PORT__ = "${hmrPort}";
+          window.__HMR_PORT__ = "${serverPort || hmrPort}";
           window.__HMR_HOSTNAME__ = "localhost";
           window.__HMR_BASE__ = "${base}";
           window.__HMR_DIRECT_TARGET__ = false;
           window.__HMR_ENABLE_OVERLAY__ = false;
           window.__HMR_TIMEOUT__ = 30;
         </script>
+        <script type="module">${reloadScript}</script>
         </head>`,
-			)
-			.replace(
-				'<div id="app"></div>',
-				`<div id="app">${rendered.html ?? ""}</div>`,
-			)
+				)
+				.replace(
+					'<div id="app"></div>',
+					`<div id="app">${rendered.html ?? ""}</div>`,
+				)
+
+			res.setHeader("Content-Type", "text/html").status(200).end(html)
+		} catch (e) {
+			/** @type {Error} */
+			// @ts-ignore
+			const error = e
 
-		res.setHeader("Content-Type", "text/html").status(200).end(html)
-	} catch (e) {
-		/** @type {Error} */
-		// @ts-ignore
-		const error = e
+			vite.ssrFixStacktrace(error)
 
-		vite.ssrFixStacktrace(error)
+			console.log(error.stack)
 
-		console.log(error.stack)
+			res.status(500).setHeader("Content-Type", "text/plain").end(error.stack)
+		}
+	},
+)
 
-		res.status(500).setHeader("Content-Type", "text/plain").end(error.stack)
+// Push a full reload or a refresh of the props to every page.
+app.post("/__govite/hmr", authenticate, express.json(), (req, res) => {
+	if (req.body?.event === "reload") {
+		vite.ws.send({ type: "full-reload", path: "*" })
+	} else {
+		vite.ws.send("govite:refresh", {})
 	}
+
+	res.status(204).end()
 })
 
-app.listen(port, "0.0.0.0")
+app.use(vite.middlewares)
+
+// Only the Go process connects to the dev server, and proxies the modules.
+app
+	.listen(port, "127.0.0.1", () => ready())
+	.on("error", (error) => ready(error))
@@ -1,22 +1,61 @@
 package engine
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/lukeshay/govite/internal/logging"
+	"github.com/lukeshay/govite/pkg/node"
 	"github.com/lukeshay/govite/pkg/utils/nodejs"
 )
 
 const devServerJs = "import  '@govite/govite/server'"
 
+// devRenderPath is the path the Vite dev server renders on.
+const devRenderPath = "/__govite/render"
+
+// devHMRPath is the path of the Vite dev server that sends events to the
+// pages over the HMR websocket.
+const devHMRPath = "/__govite/hmr"
+
+// devRenderRequest is the body of a render request to the Vite dev server.
+type devRenderRequest struct {
+	URL   string `json:"url"`
+	Props any    `json:"props"`
+	// Request is the ID of the render, given back by govite.call and fetches.
+	Request string     `json:"request"`
+	Origin  string     `json:"origin"`
+	Page    *node.Page `json:"page,omitempty"`
+}
+
+// StatusError is returned when the Vite dev server responds to a render with
+// a status that is not 2xx, i.e. because the render threw.
+type StatusError struct {
+	StatusCode int
+	// Body is the body of the response, i.e. the stack of the error thrown.
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Vite dev server responded with %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
 type DevelopmentEngineOptions struct {
 	// The relative or absolute path to the directory of your vite project.
 	//
@@ -25,11 +64,23 @@ type DevelopmentEngineOptions struct {
 	// Flags are the additional startup flags that are provided to the "node"
 	// process.
 	Flags []string
-	// Port is the port to run the websocket server on. This defaults to 6543.
+	// Port is the port of the Vite dev server. Default is a free port, which
+	// is stored in node_modules/.govite and reused when the Go process
+	// restarts.
 	Port int
-	// hmrPort is the port to run the HMR server on. This defaults to 26543.
-	hmrPort int
-	// ServerPort is the port of your Go HTTP server.
+	// HMRPort is the port of the HMR websocket server of Vite. Default is a
+	// free port, which is reused like Port so that the pages reconnect to it
+	// when the Go process restarts.
+	HMRPort int
+	// ReadyTimeout is the maximum time NewDevelopmentEngine waits for the
+	// Vite dev server to start. Default is 30 seconds.
+	ReadyTimeout time.Duration
+	// RenderTimeout is the maximum time a render waits for the Vite dev
+	// server, which includes transforming the modules it imports. Default is
+	// 60 seconds.
+	RenderTimeout time.Duration
+	// ServerPort is the port of your Go HTTP server. When it is set, the
+	// browser connects the HMR websocket to it, so it must serve DevHandler.
 	ServerPort int
 	// Stdout is the output writer for the VM. Default is os.Stdout.
 	Stdout io.Writer
@@ -39,13 +90,48 @@ type DevelopmentEngineOptions struct {
 	Env []string
 	// Logger is the logger to be used for the VM.
 	Logger *slog.Logger
+	// Runtime is the Javascript runtime used to run the Vite dev server.
+	// Default is nodejs.Node.
+	Runtime nodejs.Runtime
+	// TerminateTimeout is the time the Vite dev server is given to exit after
+	// SIGTERM on Shutdown before it is killed. Default is 5 seconds.
+	TerminateTimeout time.Duration
+	// Handler serves the relative and same-origin fetches made while
+	// rendering in-process, i.e. the http.Handler of your API. Pass the
+	// request being rendered with WithRequest to forward its cookies.
+	// Default is none.
+	Handler http.Handler
 }
 
 type DevelopmentEngine struct {
-	log    *slog.Logger
-	cmd    *exec.Cmd
-	port   int
-	appDir string
+	log              *slog.Logger
+	cmd              *exec.Cmd
+	port             int
+	hmrPort          int
+	appDir           string
+	terminateTimeout time.Duration
+	// exited is closed once the Vite dev server exited with exitErr.
+	exited  chan struct{}
+	exitErr error
+	// ready is closed once the Vite dev server started or failed to start
+	// with readyErr.
+	ready     chan struct{}
+	readyOnce sync.Once
+	readyErr  error
+	// output is the end of the output of the Vite dev server on stderr.
+	output   *tailWriter
+	stopping atomic.Bool
+	// stdin of the Vite dev server, which exits when it is closed.
+	stdin io.Closer
+	// client makes the renders to the Vite dev server.
+	client        *http.Client
+	renderTimeout time.Duration
+	// pending are the renders that were not answered yet.
+	pending  sync.Map
+	nextID   atomic.Int64
+	funcs    node.Funcs
+	handler  http.Handler
+	loopback *loopback
 }
 
 // NewDevelopmentEngine Creates a new Engine instance to be utilized in
@@ -57,44 +143,211 @@ func NewDevelopmentEngine(options DevelopmentEngineOptions) (Engine, error) {
 	}
 	log := logging.NewDefaultLogger(options.Logger)
 
-	port := options.Port
-	if port == 0 {
-		port = 6543
+	reuse := true
+
+	for attempt := 1; ; attempt++ {
+		ports, err := pickDevPorts(appAbs, options.Port, options.HMRPort, reuse)
+		if err != nil {
+			return nil, StartViteDevServerError.FormatErr(err)
+		}
+
+		engine, err := startDevelopmentEngine(options, appAbs, log, ports)
+		if err == nil {
+			return engine, nil
+		}
+
+		// A free port may be taken by another process before Vite binds it.
+		if ports.automatic && attempt < 3 && isAddrInUse(err) {
+			log.Debug("Port of the Vite dev server is in use, picking others", "port", ports.Port, "hmrPort", ports.HMRPort)
+
+			reuse = false
+
+			continue
+		}
+
+		return nil, err
+	}
+}
+
+// startDevelopmentEngine starts the Vite dev server on the ports and waits
+// for it to be ready.
+func startDevelopmentEngine(options DevelopmentEngineOptions, appAbs string, log *slog.Logger, ports devPorts) (*DevelopmentEngine, error) {
+	port, hmrPort := ports.Port, ports.HMRPort
+
+	var err error
+
+	engine := &DevelopmentEngine{
+		log:     log,
+		port:    port,
+		hmrPort: hmrPort,
+		appDir:  appAbs,
+		exited:  make(chan struct{}),
+		ready:   make(chan struct{}),
+		output:  &tailWriter{size: 4096},
+		handler: options.Handler,
+		client:  newDevClient(),
+	}
+
+	engine.renderTimeout = options.RenderTimeout
+	if engine.renderTimeout == 0 {
+		engine.renderTimeout = 60 * time.Second
 	}
-	hmrPort := options.hmrPort
-	if hmrPort == 0 {
-		hmrPort = 26543
+
+	engine.loopback, err = newLoopback(engine.loopbackHandler())
+	if err != nil {
+		return nil, CreateNodeJSVMError.FormatErr(err)
+	}
+
+	env := engine.loopback.Env()
+	env["NODE_PATH"] = fmt.Sprintf("%s/node_modules", appAbs)
+	env["PORT"] = fmt.Sprintf("%d", port)
+	env["HMR_PORT"] = fmt.Sprintf("%d", hmrPort)
+	env["SERVER_PORT"] = fmt.Sprintf("%d", options.ServerPort)
+	if options.Handler != nil {
+		env["GOVITE_FETCH"] = "1"
 	}
 
 	cmd := nodejs.NewNodeJSCommand(nodejs.NodeJSCommandOptions{
-		Script: devServerJs,
-		Dir:    appAbs,
-		Flags:  options.Flags,
-		Stdout: options.Stdout,
-		Stderr: options.Stderr,
-		Env: map[string]string{
-			"NODE_PATH":   fmt.Sprintf("%s/node_modules", appAbs),
-			"PORT":        fmt.Sprintf("%d", port),
-			"HMR_PORT":    fmt.Sprintf("%d", hmrPort),
-			"SERVER_PORT": fmt.Sprintf("%d", options.ServerPort),
-		},
+		Runtime: options.Runtime,
+		Script:  devServerJs,
+		Dir:     appAbs,
+		Flags:   options.Flags,
+		Stdout:  options.Stdout,
+		Stderr:  engine.output,
+		Env:     env,
 	})
 
+	if options.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(options.Stderr, engine.output)
+	}
+
 	cmd.Env = append(cmd.Env, options.Env...)
 
-	log.Debug("Starting Vite dev server", "port", port)
+	// Vite starts child processes, i.e. esbuild, which are stopped with the
+	// process group.
+	nodejs.SetProcessGroup(cmd)
+
+	// The dev server exits when its stdin is closed, which happens even if
+	// the Go process is killed, i.e. when it is restarted by a file watcher.
+	engine.stdin, err = cmd.StdinPipe()
+	if err != nil {
+		engine.loopback.Close()
+		return nil, CreateNodeJSVMError.FormatErr(err)
+	}
+
+	log.Debug("Starting Vite dev server", "port", port, "hmrPort", hmrPort)
 
 	if err := cmd.Start(); err != nil {
 		log.Error("Error starting Vite dev server", "error", err.Error())
+		engine.loopback.Close()
 		return nil, CreateNodeJSVMError.FormatErr(err)
 	}
 
-	return &DevelopmentEngine{
-		log:    log,
-		cmd:    cmd,
-		port:   port,
-		appDir: appAbs,
-	}, nil
+	engine.cmd = cmd
+	engine.terminateTimeout = options.TerminateTimeout
+	if engine.terminateTimeout == 0 {
+		engine.terminateTimeout = 5 * time.Second
+	}
+
+	go func() {
+		engine.exitErr = cmd.Wait()
+
+		if !engine.stopping.Load() {
+			log.Info("Vite dev server exited", "error", engine.exitErr)
+		}
+
+		close(engine.exited)
+	}()
+
+	readyTimeout := options.ReadyTimeout
+	if readyTimeout == 0 {
+		readyTimeout = 30 * time.Second
+	}
+
+	if err := engine.waitForReady(readyTimeout); err != nil {
+		log.Error("Error starting Vite dev server", "error", err.Error())
+		engine.Close()
+		return nil, StartViteDevServerError.FormatErr(err)
+	}
+
+	log.Debug("Vite dev server is ready", "port", port)
+
+	return engine, nil
+}
+
+// waitForReady waits for the Vite dev server to report that it started, or
+// that it failed to, for at most timeout.
+func (e *DevelopmentEngine) waitForReady(timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-e.ready:
+		return e.readyErr
+	case <-e.exited:
+		return fmt.Errorf("exited before it was ready: %w%s", e.exitErr, e.output.Suffix())
+	case <-timer.C:
+		return fmt.Errorf("not ready after %s%s", timeout, e.output.Suffix())
+	}
+}
+
+// setReady records that the Vite dev server started, or failed to with err.
+func (e *DevelopmentEngine) setReady(err error) {
+	e.readyOnce.Do(func() {
+		e.readyErr = err
+		close(e.ready)
+	})
+}
+
+// newDevClient returns the client of the renders. Connections to the Vite dev
+// server are kept alive and never go through a proxy.
+func newDevClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			MaxIdleConns:        64,
+			MaxIdleConnsPerHost: 64,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// tailWriter keeps the last size bytes written to it.
+type tailWriter struct {
+	mutex sync.Mutex
+	size  int
+	data  []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.data = append(w.data, p...)
+	if len(w.data) > w.size {
+		w.data = w.data[len(w.data)-w.size:]
+	}
+
+	return len(p), nil
+}
+
+// Suffix returns the data as a suffix for an error message, or nothing if
+// nothing was written.
+func (w *tailWriter) Suffix() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	output := strings.TrimSpace(string(w.data))
+	if output == "" {
+		return ""
+	}
+
+	return "\n" + output
 }
 
 // MustNewDevelopmentEngine is like New, but panics if an error occurs.
@@ -110,34 +363,67 @@ func MustNewDevelopmentEngine(options DevelopmentEngineOptions) Engine {
 }
 
 func (e *DevelopmentEngine) Render(path string, props any) (*RenderResult, error) {
-	marshalledProps, err := json.Marshal(props)
+	return e.RenderContext(context.Background(), path, props)
+}
+
+func (e *DevelopmentEngine) RenderContext(ctx context.Context, path string, props any) (*RenderResult, error) {
+	if e.stopping.Load() {
+		return nil, node.ErrShuttingDown
+	}
+
+	// Funcs called by the render must not outlive it.
+	ctx, cancel := context.WithTimeout(ctx, e.renderTimeout)
+	defer cancel()
+
+	id := strconv.FormatInt(e.nextID.Add(1), 10)
+
+	e.pending.Store(id, &devRender{ctx: ctx, startedAt: time.Now()})
+	defer e.pending.Delete(id)
+
+	render := devRenderRequest{
+		URL:     path,
+		Props:   props,
+		Request: id,
+		Origin:  node.Origin(ctx),
+	}
+
+	if page, ok := node.PageFromContext(ctx); ok {
+		render.Page = &page
+	}
+
+	body, err := json.Marshal(render)
 	if err != nil {
 		e.log.Debug("Could not marshal JSON", "error", err.Error())
 		return nil, JSONMarshalError.FormatErr(err)
 	}
 
-	// urlendcode props
-	requestURL, err := url.Parse(fmt.Sprintf("http://localhost:%d%s?props=%s", e.port, path, url.QueryEscape(string(marshalledProps))))
+	e.log.Debug("Making request", "path", path, "request", id)
+
+	req, err := e.newDevRequest(ctx, devRenderPath, body)
 	if err != nil {
-		e.log.Debug("Could not parse URL", "error", err.Error())
-		// TODO
-		return nil, err
+		e.log.Debug("Could not create request", "error", err.Error())
+		return nil, ExecuteNodeJSCodeError.FormatErr(err)
 	}
 
-	e.log.Debug("Making request", "url", requestURL.String())
-
-	res, err := http.Get(requestURL.String())
+	res, err := e.client.Do(req)
 	if err != nil {
 		e.log.Debug("Could not make request", "error", err.Error())
-		// TODO
-		return nil, err
+		return nil, ExecuteNodeJSCodeError.FormatErr(err)
 	}
 
+	defer res.Body.Close()
+
 	resBody, err := io.ReadAll(res.Body)
 	if err != nil {
 		e.log.Debug("Could not read response body", "error", err.Error())
-		// TODO
-		return nil, err
+		return nil, ExecuteNodeJSCodeError.FormatErr(err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, ExecuteNodeJSCodeError.FormatErr(&StatusError{
+			StatusCode: res.StatusCode,
+			Body:       string(resBody),
+		})
 	}
 
 	return &RenderResult{
@@ -147,8 +433,227 @@ func (e *DevelopmentEngine) Render(path string, props any) (*RenderResult, error
 	}, nil
 }
 
+// Reload makes every page open in the browser reload.
+func (e *DevelopmentEngine) Reload(ctx context.Context) error {
+	return e.sendHMR(ctx, "reload")
+}
+
+// Refresh makes every page open in the browser fetch its props as JSON again,
+// which requires the pages to be served by a router. Pages whose props changed
+// dispatch a cancelable "govite:props" event on window with them, and reload
+// unless a listener calls preventDefault. Pages rendered before the Go process
+// restarted reload on their own once the HMR websocket reconnects.
+func (e *DevelopmentEngine) Refresh(ctx context.Context) error {
+	return e.sendHMR(ctx, "refresh")
+}
+
+// sendHMR sends the event to the pages over the HMR websocket of Vite.
+func (e *DevelopmentEngine) sendHMR(ctx context.Context, event string) error {
+	body, err := json.Marshal(map[string]string{"event": event})
+	if err != nil {
+		return JSONMarshalError.FormatErr(err)
+	}
+
+	req, err := e.newDevRequest(ctx, devHMRPath, body)
+	if err != nil {
+		return err
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		resBody, _ := io.ReadAll(res.Body)
+
+		return &StatusError{StatusCode: res.StatusCode, Body: string(resBody)}
+	}
+
+	return nil
+}
+
+// newDevRequest returns a request posting the JSON body to the path of the
+// Vite dev server. It carries the token of the loopback, as the dev server
+// only accepts requests from the Go process.
+func (e *DevelopmentEngine) newDevRequest(ctx context.Context, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d%s", e.port, path), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.loopback.token)
+
+	return req, nil
+}
+
+// Ready blocks until the Vite dev server accepts connections.
+func (e *DevelopmentEngine) Ready(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if err := e.dial(ctx); err == nil {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return NotReadyError.FormatErr(ctx.Err())
+		}
+	}
+}
+
+// Health reports the Vite dev server as the only worker of the engine.
+func (e *DevelopmentEngine) Health(ctx context.Context) node.Health {
+	worker := node.WorkerHealth{
+		ID:  "vite",
+		PID: e.cmd.Process.Pid,
+	}
+
+	start := time.Now()
+
+	if err := e.dial(ctx); err != nil {
+		worker.State = node.WorkerStarting
+		worker.Error = err.Error()
+	} else {
+		worker.State = node.WorkerReady
+		worker.Latency = time.Since(start)
+	}
+
+	return node.Health{
+		Healthy: worker.State == node.WorkerReady,
+		Workers: []node.WorkerHealth{worker},
+	}
+}
+
+// Stats reports the Vite dev server as the only worker of the engine. Renders
+// are not queued in development.
+func (e *DevelopmentEngine) Stats() node.Stats {
+	return node.Stats{
+		Workers: []node.WorkerStats{{PID: e.cmd.Process.Pid}},
+	}
+}
+
+func (e *DevelopmentEngine) dial(ctx context.Context) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", fmt.Sprintf("127.0.0.1:%d", e.port))
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// Shutdown stops accepting renders and waits for the pending ones to finish
+// or the context to be done. The Vite dev server is then sent SIGTERM and
+// killed with its process group if it did not exit after the terminate
+// timeout.
+func (e *DevelopmentEngine) Shutdown(ctx context.Context) error {
+	e.stopping.Store(true)
+
+	var result *node.ShutdownError
+
+	if err := e.waitForPendingRenders(ctx); err != nil {
+		result = &node.ShutdownError{Pending: e.pendingRenders(), Err: err}
+
+		e.log.Info("Shutting down with pending renders", "pending", len(result.Pending), "error", err)
+	}
+
+	if err := nodejs.Terminate(e.cmd); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		e.log.Debug("Error terminating Vite dev server", "error", err.Error())
+	}
+
+	timeout := time.NewTimer(e.terminateTimeout)
+	defer timeout.Stop()
+
+	select {
+	case <-e.exited:
+	case <-timeout.C:
+		e.log.Info("Killing Vite dev server that did not exit", "pid", e.cmd.Process.Pid)
+	}
+
+	// The group is killed even if the dev server exited, so none of its child
+	// processes are left behind.
+	if err := e.Close(); err != nil {
+		return err
+	}
+
+	if result != nil {
+		return result
+	}
+
+	return nil
+}
+
+func (e *DevelopmentEngine) waitForPendingRenders(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		empty := true
+		e.pending.Range(func(_, _ any) bool {
+			empty = false
+
+			return false
+		})
+
+		if empty {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (e *DevelopmentEngine) pendingRenders() []node.PendingRequest {
+	var pending []node.PendingRequest
+
+	e.pending.Range(func(key, value any) bool {
+		pending = append(pending, node.PendingRequest{
+			ID:   key.(string),
+			Type: "render",
+			Age:  time.Since(value.(*devRender).startedAt),
+		})
+
+		return true
+	})
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Age > pending[j].Age
+	})
+
+	return pending
+}
+
+// RegisterFunc makes fn callable from the render as
+// `await govite.call(name, args)`.
+func (e *DevelopmentEngine) RegisterFunc(name string, fn node.Func) {
+	e.funcs.Register(name, fn)
+}
+
+// Close kills the Vite dev server with its process group.
 func (e *DevelopmentEngine) Close() error {
-	return e.cmd.Cancel()
+	e.stopping.Store(true)
+
+	e.loopback.Close()
+	e.stdin.Close()
+	e.client.CloseIdleConnections()
+
+	if err := nodejs.Kill(e.cmd); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+
+	return nil
 }
 
 func (e *DevelopmentEngine) StaticPath() string {
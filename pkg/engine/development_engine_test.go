@@ -0,0 +1,258 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lukeshay/govite/pkg/node"
+)
+
+func TestDevelopmentEngineWaitsForReady(t *testing.T) {
+	eng := newTestDevelopmentEngine(t)
+
+	// The first render does not race the start of the dev server.
+	result, err := eng.Render("/users/7", map[string]any{"id": 7})
+	if err != nil {
+		t.Fatalf("could not render: %v", err)
+	}
+	if !strings.Contains(result.Content, `/users/7 {"props":{"id":7}}`) {
+		t.Errorf("unexpected page %s", result.Content)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := eng.Ready(ctx); err != nil {
+		t.Errorf("expected the engine to be ready, got %v", err)
+	}
+}
+
+func TestDevelopmentEngineStartErrors(t *testing.T) {
+	tests := []struct {
+		mode    string
+		wantErr string
+	}{
+		{mode: "error", wantErr: "Failed to load PostCSS config"},
+		{mode: "crash", wantErr: "Cannot find package 'vite'"},
+		{mode: "hang", wantErr: "not ready after 500ms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			_, err := NewDevelopmentEngine(DevelopmentEngineOptions{
+				AppDir:       devApp(t),
+				Env:          []string{"FAKE_MODE=" + tt.mode},
+				ReadyTimeout: 500 * time.Millisecond,
+				Stdout:       io.Discard,
+				Stderr:       io.Discard,
+			})
+
+			if !StartViteDevServerError.Is(err) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected a start error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDevelopmentEnginePicksOtherPortsWhenInUse(t *testing.T) {
+	dir := devApp(t)
+
+	eng := newTestDevelopmentEngine(t, DevelopmentEngineOptions{AppDir: dir, Env: []string{"FAKE_MODE=in-use"}})
+
+	taken, err := os.ReadFile(filepath.Join(dir, "in-use"))
+	if err != nil {
+		t.Fatalf("expected the first start to fail: %v", err)
+	}
+	if string(taken) == strconv.Itoa(eng.port) {
+		t.Errorf("expected another port than %s", taken)
+	}
+
+	if _, err := eng.Render("/", nil); err != nil {
+		t.Errorf("could not render: %v", err)
+	}
+}
+
+func TestDevelopmentEngineConfiguredPorts(t *testing.T) {
+	dir := devApp(t)
+
+	ports, err := pickDevPorts(t.TempDir(), 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eng := newTestDevelopmentEngine(t, DevelopmentEngineOptions{AppDir: dir, Port: ports.Port, HMRPort: ports.HMRPort})
+
+	if eng.port != ports.Port || eng.hmrPort != ports.HMRPort {
+		t.Errorf("expected ports %+v, got %d and %d", ports, eng.port, eng.hmrPort)
+	}
+	if _, err := os.Stat(devPortsFile(dir)); !os.IsNotExist(err) {
+		t.Errorf("expected configured ports not to be stored, got %v", err)
+	}
+}
+
+func TestDevelopmentEngineRenderSendsProps(t *testing.T) {
+	eng := newTestDevelopmentEngine(t)
+
+	large := strings.Repeat("x", 1<<20)
+
+	result, err := eng.Render("/users/7", map[string]any{"large": large})
+	if err != nil {
+		t.Fatalf("could not render: %v", err)
+	}
+	if !strings.Contains(result.Content, large) {
+		t.Error("expected the props to be rendered")
+	}
+	if result.ContentType != "text/html" {
+		t.Errorf("unexpected content type %q", result.ContentType)
+	}
+}
+
+func TestDevelopmentEngineRenderErrors(t *testing.T) {
+	eng := newTestDevelopmentEngine(t, DevelopmentEngineOptions{RenderTimeout: 200 * time.Millisecond})
+
+	_, err := eng.Render("/", map[string]any{"throw": "boom in render"})
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError || !strings.Contains(statusErr.Body, "boom in render") {
+		t.Errorf("expected a StatusError with the stack, got %v", err)
+	}
+
+	if _, err := eng.Render("/", map[string]any{"sleep": 1000}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the render to time out, got %v", err)
+	}
+
+	if _, err := eng.Render("/", nil); err != nil {
+		t.Errorf("could not render after a timeout: %v", err)
+	}
+}
+
+func TestDevelopmentEngineCallsFuncs(t *testing.T) {
+	eng := newTestDevelopmentEngine(t)
+
+	eng.RegisterFunc("add", node.FuncOf(func(ctx context.Context, args []int) (int, error) {
+		return args[0] + args[1], nil
+	}))
+
+	result, err := eng.Render("/", map[string]any{"call": "add", "args": []int{2, 3}})
+	if err != nil {
+		t.Fatalf("could not render: %v", err)
+	}
+	if !strings.Contains(result.Content, "/ 5") {
+		t.Errorf("expected the result of the func, got %s", result.Content)
+	}
+}
+
+func TestDevelopmentEngineShutdown(t *testing.T) {
+	eng := newTestDevelopmentEngine(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := eng.Shutdown(ctx); err != nil {
+		t.Fatalf("could not shut down: %v", err)
+	}
+
+	select {
+	case <-eng.exited:
+	default:
+		t.Error("expected the dev server to have exited")
+	}
+
+	if _, err := eng.Render("/", nil); !errors.Is(err, node.ErrShuttingDown) {
+		t.Errorf("expected %v, got %v", node.ErrShuttingDown, err)
+	}
+}
+
+// output is an io.Writer safe for concurrent use.
+type output struct {
+	mutex sync.Mutex
+	data  strings.Builder
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.data.Write(p)
+}
+
+func (o *output) String() string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.data.String()
+}
+
+func TestDevelopmentEngineRestart(t *testing.T) {
+	dir := devApp(t)
+
+	first := newTestDevelopmentEngine(t, DevelopmentEngineOptions{AppDir: dir})
+
+	if err := first.Close(); err != nil {
+		t.Fatalf("could not close: %v", err)
+	}
+
+	// The Go process restarted, i.e. by a file watcher. The pages it rendered
+	// reconnect to the HMR websocket on the same port and reload.
+	stderr := &output{}
+	second := newTestDevelopmentEngine(t, DevelopmentEngineOptions{AppDir: dir, Stderr: stderr})
+
+	if second.port != first.port || second.hmrPort != first.hmrPort {
+		t.Fatalf("expected the ports %d and %d to be kept, got %d and %d", first.port, first.hmrPort, second.port, second.hmrPort)
+	}
+
+	res, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d", second.hmrPort))
+	if err != nil {
+		t.Fatalf("expected the HMR server to answer on the kept port: %v", err)
+	}
+	res.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := second.Refresh(ctx); err != nil {
+		t.Fatalf("could not refresh: %v", err)
+	}
+	if err := second.Reload(ctx); err != nil {
+		t.Fatalf("could not reload: %v", err)
+	}
+
+	// The dev server logs the events after it answered.
+	deadline := time.Now().Add(5 * time.Second)
+
+	for _, want := range []string{"hmr refresh", "hmr reload"} {
+		for !strings.Contains(stderr.String(), want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the dev server to get %q, got %q", want, stderr.String())
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestDevelopmentEngineRequestsAreAuthenticated(t *testing.T) {
+	eng := newTestDevelopmentEngine(t)
+
+	for _, path := range []string{devRenderPath, devHMRPath} {
+		res, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d%s", eng.port, path), "application/json", strings.NewReader(`{"event":"reload"}`))
+		if err != nil {
+			t.Fatalf("could not post: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected %s to be rejected without the token, got %d", path, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// devPrefixes are the paths of the modules served by the Vite dev server.
+var devPrefixes = []string{
+	"/@vite/",
+	"/@id/",
+	"/@fs/",
+	"/@react-refresh",
+	"/src/",
+	"/node_modules/",
+}
+
+// DevHandler returns an http.Handler serving the modules and the HMR
+// websocket of the Vite dev server of a development engine, and every other
+// request with next. Mounting it as the handler of your Go server means that
+// only its port has to be opened in the browser, exposed from containers or
+// forwarded over SSH. For any other engine DevHandler returns next.
+func DevHandler(e Engine, next http.Handler) http.Handler {
+	dev, ok := e.(*DevelopmentEngine)
+	if !ok {
+		return next
+	}
+
+	return dev.Handler(next)
+}
+
+// Handler returns an http.Handler reverse-proxying the modules and the HMR
+// websocket to the Vite dev server and serving every other request with next.
+// Vite is told to connect the HMR websocket to ServerPort, so the handler must
+// be served on it.
+func (e *DevelopmentEngine) Handler(next http.Handler) http.Handler {
+	modules := e.newProxy(e.port)
+	hmr := e.newProxy(e.hmrPort)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case isHMRRequest(r):
+			hmr.ServeHTTP(w, r)
+		case isModuleRequest(r):
+			modules.ServeHTTP(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func (e *DevelopmentEngine) newProxy(port int) *httputil.ReverseProxy {
+	target := &url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", port)}
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			e.log.Debug("Error proxying to Vite dev server", "path", r.URL.Path, "error", err)
+
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+}
+
+// isHMRRequest reports whether r opens the HMR websocket or is the ping the
+// Vite client sends before reconnecting it.
+func isHMRRequest(r *http.Request) bool {
+	if r.Header.Get("Accept") == "text/x-vite-ping" {
+		return true
+	}
+
+	for _, protocol := range r.Header.Values("Sec-WebSocket-Protocol") {
+		if strings.Contains(protocol, "vite-hmr") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isModuleRequest(r *http.Request) bool {
+	for _, prefix := range devPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
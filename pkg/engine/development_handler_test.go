@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// serverPort starts a server answering with its name and returns its port.
+func serverPort(t *testing.T, name string) int {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name+" "+r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestDevHandler(t *testing.T) {
+	dev := &DevelopmentEngine{
+		log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		port:    serverPort(t, "vite"),
+		hmrPort: serverPort(t, "hmr"),
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "go "+r.URL.Path)
+	})
+
+	handler := DevHandler(dev, next)
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		want   string
+	}{
+		{name: "client", path: "/@vite/client", want: "vite /@vite/client"},
+		{name: "source", path: "/src/main.tsx", want: "vite /src/main.tsx"},
+		{name: "dependency", path: "/node_modules/.vite/deps/react.js", want: "vite /node_modules/.vite/deps/react.js"},
+		{name: "ping", path: "/", header: http.Header{"Accept": {"text/x-vite-ping"}}, want: "hmr /"},
+		{name: "websocket", path: "/", header: http.Header{"Sec-Websocket-Protocol": {"vite-hmr"}}, want: "hmr /"},
+		{name: "page", path: "/users/7", want: "go /users/7"},
+		{name: "similar path", path: "/srcs", want: "go /srcs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDevHandlerBadGateway(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	dev := &DevelopmentEngine{log: slog.New(slog.NewTextHandler(io.Discard, nil)), port: port, hmrPort: port}
+
+	w := httptest.NewRecorder()
+
+	dev.Handler(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/@vite/client", nil))
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected %d, got %d", http.StatusBadGateway, w.Code)
+	}
+}
+
+func TestDevHandlerOtherEngines(t *testing.T) {
+	next := http.NotFoundHandler()
+
+	w := httptest.NewRecorder()
+
+	DevHandler(&ProductionEngine{}, next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/@vite/client", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected next to serve the request, got %d", w.Code)
+	}
+}
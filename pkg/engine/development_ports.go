@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// portReleaseTimeout is the time a stored port is given to be released by the
+// Vite dev server of the previous Go process, which exits with it.
+var portReleaseTimeout = 3 * time.Second
+
+// devPorts are the ports of the Vite dev server.
+type devPorts struct {
+	Port    int `json:"port"`
+	HMRPort int `json:"hmrPort"`
+	// automatic is set if one of the ports was picked automatically.
+	automatic bool
+}
+
+// devPortsFile returns the file the ports picked for the project in appDir are
+// stored in.
+func devPortsFile(appDir string) string {
+	return filepath.Join(appDir, "node_modules", ".govite", "ports.json")
+}
+
+// pickDevPorts returns the configured ports, and free ports for the ones that
+// are 0. Free ports are stored, and reused by the next Go process if reuse is
+// set, so that the pages it rendered reconnect to the HMR websocket after it
+// restarted.
+func pickDevPorts(appDir string, port int, hmrPort int, reuse bool) (devPorts, error) {
+	ports := devPorts{Port: port, HMRPort: hmrPort}
+	if port != 0 && hmrPort != 0 {
+		return ports, nil
+	}
+
+	ports.automatic = true
+
+	var stored devPorts
+	if reuse {
+		if data, err := os.ReadFile(devPortsFile(appDir)); err == nil {
+			json.Unmarshal(data, &stored)
+		}
+	}
+
+	var err error
+
+	if ports.Port == 0 {
+		if ports.Port, err = pickPort(stored.Port, ports.HMRPort); err != nil {
+			return ports, err
+		}
+	}
+	if ports.HMRPort == 0 {
+		if ports.HMRPort, err = pickPort(stored.HMRPort, ports.Port); err != nil {
+			return ports, err
+		}
+	}
+
+	if data, err := json.Marshal(ports); err == nil {
+		file := devPortsFile(appDir)
+
+		if os.MkdirAll(filepath.Dir(file), 0o755) == nil {
+			os.WriteFile(file, data, 0o644)
+		}
+	}
+
+	return ports, nil
+}
+
+// pickPort returns the stored port once it is free, or a free port if there
+// is none or it is still in use after portReleaseTimeout. The port is never
+// taken.
+func pickPort(stored int, taken int) (int, error) {
+	if stored != 0 && stored != taken {
+		deadline := time.Now().Add(portReleaseTimeout)
+
+		for {
+			if portFree(stored) {
+				return stored, nil
+			}
+			if time.Now().After(deadline) {
+				break
+			}
+
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	for {
+		port, err := freePort()
+		if err != nil || port != taken {
+			return port, err
+		}
+	}
+}
+
+// portFree reports whether the port can be listened on.
+func portFree(port int) bool {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+
+	listener.Close()
+
+	return true
+}
+
+// freePort returns a port that is free. It may be taken by another process
+// before it is listened on.
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// isAddrInUse reports whether the Vite dev server failed to start because one
+// of its ports is in use.
+func isAddrInUse(err error) bool {
+	return strings.Contains(err.Error(), "EADDRINUSE")
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPickDevPortsReusesStoredPorts(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := pickDevPorts(dir, 0, 0, true)
+	if err != nil {
+		t.Fatalf("could not pick ports: %v", err)
+	}
+	if !first.automatic || first.Port == 0 || first.HMRPort == 0 || first.Port == first.HMRPort {
+		t.Fatalf("expected two distinct free ports, got %+v", first)
+	}
+
+	second, err := pickDevPorts(dir, 0, 0, true)
+	if err != nil {
+		t.Fatalf("could not pick ports: %v", err)
+	}
+	if second.Port != first.Port || second.HMRPort != first.HMRPort {
+		t.Errorf("expected the stored ports %+v, got %+v", first, second)
+	}
+
+	configured, err := pickDevPorts(dir, 6543, 0, true)
+	if err != nil {
+		t.Fatalf("could not pick ports: %v", err)
+	}
+	if configured.Port != 6543 || configured.HMRPort != first.HMRPort {
+		t.Errorf("expected the configured port and the stored HMR port, got %+v", configured)
+	}
+
+	if ports, _ := pickDevPorts(dir, 6543, 26543, true); ports.automatic || ports.Port != 6543 || ports.HMRPort != 26543 {
+		t.Errorf("expected the configured ports, got %+v", ports)
+	}
+}
+
+func TestPickDevPortsWaitsForStoredPorts(t *testing.T) {
+	dir := t.TempDir()
+
+	stored, err := pickDevPorts(dir, 0, 0, true)
+	if err != nil {
+		t.Fatalf("could not pick ports: %v", err)
+	}
+
+	// The Vite dev server of the previous Go process releases the port
+	// shortly after the new one starts.
+	listener, err := net.Listen("tcp", (&net.TCPAddr{Port: stored.HMRPort}).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.AfterFunc(200*time.Millisecond, func() { listener.Close() })
+
+	ports, err := pickDevPorts(dir, 0, 0, true)
+	if err != nil {
+		t.Fatalf("could not pick ports: %v", err)
+	}
+	if ports.HMRPort != stored.HMRPort {
+		t.Errorf("expected the released HMR port %d, got %d", stored.HMRPort, ports.HMRPort)
+	}
+}
+
+func TestPickDevPortsSkipsTakenPorts(t *testing.T) {
+	defer func(timeout time.Duration) { portReleaseTimeout = timeout }(portReleaseTimeout)
+
+	portReleaseTimeout = 100 * time.Millisecond
+
+	dir := t.TempDir()
+
+	stored, err := pickDevPorts(dir, 0, 0, true)
+	if err != nil {
+		t.Fatalf("could not pick ports: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", (&net.TCPAddr{Port: stored.Port}).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ports, err := pickDevPorts(dir, 0, 0, true)
+	if err != nil {
+		t.Fatalf("could not pick ports: %v", err)
+	}
+	if ports.Port == stored.Port || ports.HMRPort != stored.HMRPort {
+		t.Errorf("expected a new port and the stored HMR port, got %+v for %+v", ports, stored)
+	}
+
+	if fresh, _ := pickDevPorts(dir, 0, 0, false); fresh.Port == ports.Port && fresh.HMRPort == ports.HMRPort {
+		t.Errorf("expected new ports without reuse, got %+v", fresh)
+	}
+}
+
+func TestIsAddrInUse(t *testing.T) {
+	err := StartViteDevServerError.FormatErr(errors.New("Error: listen EADDRINUSE: address already in use 0.0.0.0:6543"))
+
+	if !isAddrInUse(err) {
+		t.Errorf("expected %v to be an address in use", err)
+	}
+	if isAddrInUse(errors.New("Cannot find module 'vite'")) {
+		t.Error("expected other errors not to be an address in use")
+	}
+}
+
+func TestTailWriter(t *testing.T) {
+	w := &tailWriter{size: 8}
+
+	if suffix := w.Suffix(); suffix != "" {
+		t.Errorf("expected no suffix, got %q", suffix)
+	}
+
+	w.Write([]byte("starting\n"))
+	w.Write([]byte("error: boom \n"))
+
+	if suffix := w.Suffix(); suffix != "\n: boom" {
+		t.Errorf("expected the last bytes, got %q", suffix)
+	}
+}
@@ -1,9 +1,12 @@
 package engine
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/lukeshay/govite/pkg/node"
 )
 
 type Error struct {
@@ -26,8 +29,10 @@ func (ec *ErrorCreator) Format(message string) error {
 	return fmt.Errorf("%s: %s", ec.prefix, message)
 }
 
+// FormatErr wraps err so that it can still be matched with errors.Is and
+// errors.As.
 func (ec *ErrorCreator) FormatErr(err error) error {
-	return ec.Format(err.Error())
+	return fmt.Errorf("%s: %w", ec.prefix, err)
 }
 
 func (ec *ErrorCreator) Is(err error) bool {
@@ -50,6 +55,7 @@ var (
 	ExecuteNodeJSCodeError  = newErrorCreator("Could not execute Node.js code")
 	InterfaceCastError      = newErrorCreator("Could not cast interface")
 	StartViteDevServerError = newErrorCreator("Could not start Vite dev server")
+	NotReadyError           = newErrorCreator("Engine is not ready")
 )
 
 type RenderResult struct {
@@ -61,12 +67,42 @@ type RenderResult struct {
 type Engine interface {
 	// Render renders the given url with the given props.
 	Render(url string, props any) (*RenderResult, error)
-	// Close closes the engine.
+	// RenderContext is like Render, but stops waiting for the render when the
+	// context is done. Renders that were shed because the engine is
+	// overloaded return an error matching node.ErrOverloaded.
+	RenderContext(ctx context.Context, url string, props any) (*RenderResult, error)
+	// Ready blocks until the engine is able to render or the context is done.
+	Ready(ctx context.Context) error
+	// Health reports the health of every worker of the engine.
+	Health(ctx context.Context) node.Health
+	// Stats returns a snapshot of the queue and the workers of the engine.
+	Stats() node.Stats
+	// RegisterFunc makes fn callable from the render as
+	// `await govite.call(name, args)`, with the context of the render.
+	RegisterFunc(name string, fn node.Func)
+	// Shutdown stops accepting renders and waits for the pending ones to
+	// finish or the context to be done before stopping the node processes.
+	// Renders that were still pending are reported by a *node.ShutdownError.
+	Shutdown(ctx context.Context) error
+	// Close closes the engine immediately.
 	Close() error
 	// StaticPath returns the path to the static directory.
 	StaticPath() string
 }
 
+// WithRequest returns a context carrying the request that is being rendered.
+// Fetches served by the Handler of the engine while rendering with the context
+// are resolved against its origin and carry its cookies.
+func WithRequest(ctx context.Context, r *http.Request) context.Context {
+	return node.WithRequest(ctx, r)
+}
+
+// WithPage returns a context for rendering the page, which is passed to the
+// render function of the server entry as its third argument.
+func WithPage(ctx context.Context, page node.Page) context.Context {
+	return node.WithPage(ctx, page)
+}
+
 func defaultString(value, defaultValue string) string {
 	if value == "" {
 		return defaultValue
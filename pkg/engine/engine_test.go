@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// records is a slog.Handler recording every record.
+type records struct {
+	mutex   sync.Mutex
+	records []slog.Record
+}
+
+func (r *records) Enabled(context.Context, slog.Level) bool { return true }
+func (r *records) WithAttrs([]slog.Attr) slog.Handler       { return r }
+func (r *records) WithGroup(string) slog.Handler            { return r }
+
+func (r *records) Handle(_ context.Context, record slog.Record) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.records = append(r.records, record)
+
+	return nil
+}
+
+// atLeast returns the messages of the records at level or above.
+func (r *records) atLeast(level slog.Level) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var messages []string
+
+	for _, record := range r.records {
+		if record.Level >= level {
+			messages = append(messages, record.Message)
+		}
+	}
+
+	return messages
+}
+
+// newTestProductionEngine starts a production engine rendering the build in
+// testdata/dist and closes it when the test finishes. The test is skipped with
+// -short or when node is not installed.
+func newTestProductionEngine(t *testing.T, options ...ProductionEngineOptions) *ProductionEngine {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("skipping production engine in short mode")
+	}
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skipf("node is not installed: %v", err)
+	}
+
+	option := ProductionEngineOptions{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+
+	option.DistDir = "testdata/dist"
+	option.WaitForReady = true
+
+	if option.NodeProcesses == 0 {
+		option.NodeProcesses = 1
+	}
+	if option.Logger == nil {
+		option.Logger = slog.New(&records{})
+	}
+
+	eng, err := NewProductionEngine(option)
+	if err != nil {
+		t.Fatalf("could not start production engine: %v", err)
+	}
+
+	t.Cleanup(func() { eng.Close() })
+
+	return eng.(*ProductionEngine)
+}
+
+// devApp copies the project in testdata/devapp, whose dev server is a fake
+// of the one of @govite/govite, to a temporary directory and returns it. The
+// test is skipped with -short or when node is not installed.
+func devApp(t *testing.T) string {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("skipping development engine in short mode")
+	}
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skipf("node is not installed: %v", err)
+	}
+
+	dir := t.TempDir()
+
+	err := filepath.WalkDir(filepath.Join("testdata", "devapp"), func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(filepath.Join("testdata", "devapp"), file)
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, rel), 0o755)
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(filepath.Join(dir, rel), data, 0o644)
+	})
+	if err != nil {
+		t.Fatalf("could not copy the project: %v", err)
+	}
+
+	return dir
+}
+
+// newTestDevelopmentEngine starts a development engine for the project in
+// appDir, or a copy of testdata/devapp if it is empty, and closes it when the
+// test finishes.
+func newTestDevelopmentEngine(t *testing.T, options ...DevelopmentEngineOptions) *DevelopmentEngine {
+	t.Helper()
+
+	option := DevelopmentEngineOptions{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+
+	if option.AppDir == "" {
+		option.AppDir = devApp(t)
+	}
+	if option.Logger == nil {
+		option.Logger = slog.New(&records{})
+	}
+	if option.Stdout == nil {
+		option.Stdout = io.Discard
+	}
+	if option.Stderr == nil {
+		option.Stderr = io.Discard
+	}
+
+	eng, err := NewDevelopmentEngine(option)
+	if err != nil {
+		t.Fatalf("could not start development engine: %v", err)
+	}
+
+	t.Cleanup(func() { eng.Close() })
+
+	return eng.(*DevelopmentEngine)
+}
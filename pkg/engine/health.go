@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lukeshay/govite/pkg/node"
+)
+
+// LivenessHandler returns an http.Handler to be used as a Kubernetes liveness
+// probe. It responds with 200 when at least one worker of the engine answers a
+// ping and 503 otherwise. The body is the JSON encoded node.Health.
+func LivenessHandler(e Engine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := e.Health(r.Context())
+
+		writeHealth(w, health, health.Live())
+	})
+}
+
+// ReadinessHandler returns an http.Handler to be used as a Kubernetes
+// readiness probe. It responds with 200 when every worker of the engine
+// answers a ping and 503 otherwise. The body is the JSON encoded node.Health.
+func ReadinessHandler(e Engine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := e.Health(r.Context())
+
+		writeHealth(w, health, health.Healthy)
+	})
+}
+
+func writeHealth(w http.ResponseWriter, health node.Health, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(health)
+}
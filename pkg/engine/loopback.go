@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/lukeshay/govite/pkg/node"
+)
+
+// loopback is the HTTP endpoint the Vite dev server calls back into while
+// rendering, i.e. for govite.call and fetches served by the handler, and to
+// report that it is ready. It only listens on localhost and every request must
+// carry the token given to the dev server.
+type loopback struct {
+	server   *http.Server
+	listener net.Listener
+	token    string
+}
+
+// devRender is a render made to the Vite dev server.
+type devRender struct {
+	// ctx is the context of the render, given to the Funcs it calls.
+	ctx       context.Context
+	startedAt time.Time
+}
+
+type devReady struct {
+	// Error is the error the dev server failed to start with, if any.
+	Error string `json:"error,omitempty"`
+}
+
+type devInvoke struct {
+	Request string          `json:"request"`
+	Name    string          `json:"name"`
+	Args    json.RawMessage `json:"args"`
+}
+
+type devInvokeResult struct {
+	Content any                `json:"content,omitempty"`
+	Error   *node.RuntimeError `json:"error,omitempty"`
+}
+
+func newLoopback(handler http.Handler) (*loopback, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	l := &loopback{
+		listener: listener,
+		token:    hex.EncodeToString(token),
+	}
+
+	l.server = &http.Server{
+		Handler:           l.authenticate(handler),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go l.server.Serve(listener)
+
+	return l, nil
+}
+
+// Env returns the environment variables that point the dev server at the
+// endpoint.
+func (l *loopback) Env() map[string]string {
+	return map[string]string{
+		"GOVITE_LOOPBACK": "http://" + l.listener.Addr().String(),
+		"GOVITE_TOKEN":    l.token,
+	}
+}
+
+func (l *loopback) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+l.token)) != 1 {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *loopback) Close() error {
+	return l.server.Close()
+}
+
+// loopbackHandler routes the requests of the dev server.
+func (e *DevelopmentEngine) loopbackHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /ready", e.serveReady)
+	mux.HandleFunc("POST /invoke", e.serveInvoke)
+	mux.HandleFunc("POST /fetch", e.serveFetch)
+
+	return mux
+}
+
+// serveReady records that the dev server started, or the error it failed to
+// start with.
+func (e *DevelopmentEngine) serveReady(w http.ResponseWriter, r *http.Request) {
+	var ready devReady
+	if err := json.NewDecoder(r.Body).Decode(&ready); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if ready.Error != "" {
+		e.setReady(errors.New(ready.Error))
+	} else {
+		e.setReady(nil)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveInvoke answers a call to a Func made by the dev server.
+func (e *DevelopmentEngine) serveInvoke(w http.ResponseWriter, r *http.Request) {
+	var invoke devInvoke
+	if err := json.NewDecoder(r.Body).Decode(&invoke); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	ctx := r.Context()
+	if render, ok := e.pending.Load(invoke.Request); ok {
+		ctx = render.(*devRender).ctx
+	}
+
+	var result devInvokeResult
+
+	value, err := e.funcs.Invoke(ctx, invoke.Name, invoke.Args)
+	if err != nil {
+		e.log.Debug("Func failed", "name", invoke.Name, "request", invoke.Request, "error", err.Error())
+
+		result.Error = node.FuncError(err)
+	} else {
+		result.Content = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		e.log.Debug("Could not write func result", "error", err.Error())
+	}
+}
+
+// serveFetch serves a fetch made by the dev server with the handler of the
+// engine.
+func (e *DevelopmentEngine) serveFetch(w http.ResponseWriter, r *http.Request) {
+	if e.handler == nil {
+		http.Error(w, "the engine has no handler for fetches", http.StatusNotFound)
+
+		return
+	}
+
+	var fetch node.FetchRequest
+	if err := json.NewDecoder(r.Body).Decode(&fetch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	ctx := r.Context()
+	if render, ok := e.pending.Load(fetch.Request); ok {
+		ctx = render.(*devRender).ctx
+	}
+
+	response, err := node.ServeFetch(ctx, e.handler, fetch)
+	if err != nil {
+		e.log.Debug("Fetch failed", "url", fetch.URL, "request", fetch.Request, "error", err.Error())
+
+		http.Error(w, err.Error(), http.StatusBadGateway)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		e.log.Debug("Could not write fetch response", "error", err.Error())
+	}
+}
@@ -1,30 +1,26 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/lukeshay/govite/internal/logging"
 	"github.com/lukeshay/govite/pkg/node"
-	"github.com/lukeshay/govite/pkg/utils/hash"
+	"github.com/lukeshay/govite/pkg/utils/nodejs"
 )
 
-const serverJs = `
-import { render } from "%s";
-import { env } from "node:process"
-
-export default render(%s)
-`
-
 const htmlInitialState = `<script>
   window.__INITIAL_STATE__ = %s
 </script>
-</head>`
+`
 
 type ProductionEngineOptions struct {
 	// The relative or absolute path to the dist folder of your vite project.
@@ -34,27 +30,92 @@ type ProductionEngineOptions struct {
 	// Flags are the additional startup flags that are provided to the "node"
 	// process.
 	Flags []string
-	// sort is the port to run the websocket server on. This defaults to 6543.
+	// Port is the TCP port the node processes connect to when no Transport is
+	// given. Default is an ephemeral port.
 	Port int
-	// Stdout is the output writer for the VM. Default is os.Stdout.
+	// Transport is the transport the node processes connect to. Default is a
+	// TCP transport on localhost and Port.
+	Transport node.Transport
+	// Stdout is the output writer for the VM. Default is to log every line
+	// with Logger at the info level.
 	Stdout io.Writer
-	// Stderr is the error writer for the VM. Default is os.Stderr.
+	// Stderr is the error writer for the VM. Default is to log every line
+	// with Logger at the error level.
 	Stderr io.Writer
 	// Env is the environment variables to be set for the VM.
 	Env []string
 	// NodeProcesses is the number of node processes to run. Default is 5.
 	NodeProcesses int
-	// Logger is the logger to be used for the VM.
+	// Logger is the logger to be used for the VM. Console calls made while
+	// rendering are logged with it.
 	Logger *slog.Logger
+	// Debug makes the node processes log what they are doing at the debug
+	// level.
+	Debug bool
+	// Runtime is the Javascript runtime used to run the VM. Default is
+	// nodejs.Node.
+	Runtime nodejs.Runtime
+	// WaitForReady makes NewProductionEngine block until every node process
+	// is initialized.
+	WaitForReady bool
+	// ReadyTimeout is the maximum time NewProductionEngine waits for the node
+	// processes when WaitForReady is set. Default is 30 seconds.
+	ReadyTimeout time.Duration
+	// MaxRequestsPerWorker is the number of renders after which a node process
+	// is replaced. Default is no limit.
+	MaxRequestsPerWorker int64
+	// MaxWorkerHeap is the heap size in bytes after which a node process is
+	// replaced. Default is no limit.
+	MaxWorkerHeap int64
+	// MaxWorkerAge is the time after which a node process is replaced. Default
+	// is no limit.
+	MaxWorkerAge time.Duration
+	// MaxConcurrencyPerWorker is the number of renders a single node process
+	// handles at the same time. Default is 8.
+	MaxConcurrencyPerWorker int
+	// MaxQueueSize is the number of renders that wait for a node process when
+	// every process is busy. Default is 1024.
+	MaxQueueSize int
+	// QueueTimeout is the maximum time a render waits for a node process.
+	// Default is 10 seconds.
+	QueueTimeout time.Duration
+	// Observer is notified about every render, i.e. a *metrics.Metrics.
+	// Default is none.
+	Observer node.Observer
+	// Tracer traces every render, including the spans recorded by the node
+	// processes, i.e. an *otel.Tracer. Default is none.
+	Tracer node.Tracer
+	// TerminateTimeout is the time node processes are given to exit after
+	// SIGTERM on Shutdown before they are killed. Default is 5 seconds.
+	TerminateTimeout time.Duration
+	// RenderTimeout is the maximum time a render runs on a node process. The
+	// process of a render that misses it is killed and replaced, and only
+	// that render fails with node.ErrRenderTimeout. Default is no limit.
+	RenderTimeout time.Duration
+	// MaxOldSpaceSize is the size in megabytes of the old generation of the
+	// V8 heap of every node process. Default is the V8 default.
+	MaxOldSpaceSize int
+	// MaxSemiSpaceSize is the size in megabytes of a semi-space of the young
+	// generation of the V8 heap of every node process. Default is the V8
+	// default.
+	MaxSemiSpaceSize int
+	// V8Flags are additional V8 flags for every node process. Bun ignores
+	// them.
+	V8Flags []string
+	// Handler serves the relative and same-origin fetches made while
+	// rendering in-process, i.e. the http.Handler of your API. Pass the
+	// request being rendered with WithRequest to forward its cookies.
+	// Default is none.
+	Handler http.Handler
 }
 
 type ProductionEngine struct {
 	htmlTemplate string
 	log          *slog.Logger
 	serverEntry  string
-	tempDir      string
 	distDir      string
 	vm           node.VM
+	tracer       node.Tracer
 }
 
 // NewProductionEngine Creates a new Engine instance to be utilized in
@@ -73,22 +134,36 @@ func NewProductionEngine(options ProductionEngineOptions) (Engine, error) {
 		return nil, IndexHtmlReadError.FormatErr(err)
 	}
 
-	tempDir, err := os.MkdirTemp("", "govite-*")
-	if err != nil {
-		return nil, CreateTempDirError.FormatErr(err)
-	}
-
 	log := logging.NewDefaultLogger(options.Logger)
 
 	vm, err := node.NewNodeJS(node.Options{
-		Dir:           distAbs,
-		Env:           options.Env,
-		Flags:         options.Flags,
-		Logger:        options.Logger,
-		NodeProcesses: options.NodeProcesses,
-		Port:          options.Port,
-		Stderr:        options.Stderr,
-		Stdout:        options.Stdout,
+		Debug:                   options.Debug,
+		Dir:                     distAbs,
+		Env:                     options.Env,
+		Flags:                   options.Flags,
+		Handler:                 options.Handler,
+		Logger:                  options.Logger,
+		MaxConcurrencyPerWorker: options.MaxConcurrencyPerWorker,
+		MaxOldSpaceSize:         options.MaxOldSpaceSize,
+		MaxQueueSize:            options.MaxQueueSize,
+		MaxRequestsPerWorker:    options.MaxRequestsPerWorker,
+		MaxSemiSpaceSize:        options.MaxSemiSpaceSize,
+		MaxWorkerAge:            options.MaxWorkerAge,
+		MaxWorkerHeap:           options.MaxWorkerHeap,
+		NodeProcesses:           options.NodeProcesses,
+		Observer:                options.Observer,
+		Port:                    options.Port,
+		QueueTimeout:            options.QueueTimeout,
+		ReadyTimeout:            options.ReadyTimeout,
+		RenderTimeout:           options.RenderTimeout,
+		Runtime:                 options.Runtime,
+		Stderr:                  options.Stderr,
+		Stdout:                  options.Stdout,
+		TerminateTimeout:        options.TerminateTimeout,
+		Tracer:                  options.Tracer,
+		Transport:               options.Transport,
+		V8Flags:                 options.V8Flags,
+		WaitForReady:            options.WaitForReady,
 	})
 	if err != nil {
 		return nil, CreateNodeJSVMError.FormatErr(err)
@@ -98,9 +173,9 @@ func NewProductionEngine(options ProductionEngineOptions) (Engine, error) {
 		htmlTemplate: string(htmlTemplate),
 		log:          log,
 		serverEntry:  serverEntry,
-		tempDir:      tempDir,
 		distDir:      distAbs,
 		vm:           vm,
+		tracer:       options.Tracer,
 	}, nil
 }
 
@@ -117,9 +192,15 @@ func MustNewProductionEngine(options ProductionEngineOptions) Engine {
 }
 
 func (e *ProductionEngine) Render(url string, props any) (*RenderResult, error) {
-	hash, err := hash.Hash(props)
-	if err != nil {
-		return nil, HashError.FormatErr(err)
+	return e.RenderContext(context.Background(), url, props)
+}
+
+func (e *ProductionEngine) RenderContext(ctx context.Context, url string, props any) (_ *RenderResult, err error) {
+	if e.tracer != nil {
+		var end func(error)
+
+		ctx, end = e.tracer.Start(ctx, "govite.render", map[string]any{"url.path": url})
+		defer func() { end(err) }()
 	}
 
 	marshalledProps, err := json.Marshal(props)
@@ -127,23 +208,7 @@ func (e *ProductionEngine) Render(url string, props any) (*RenderResult, error)
 		return nil, JSONMarshalError.FormatErr(err)
 	}
 
-	fileName := filepath.Join(e.tempDir, fmt.Sprintf("%s.mjs", hash))
-
-	if _, err := os.Stat(fileName); os.IsNotExist(err) {
-		file, err := os.Create(filepath.Join(e.tempDir, fmt.Sprintf("%s.mjs", hash)))
-		if err != nil {
-			return nil, CreateTempFileError.FormatErr(err)
-		}
-
-		defer file.Close()
-
-		_, err = file.Write([]byte(fmt.Sprintf(serverJs, e.serverEntry, marshalledProps)))
-		if err != nil {
-			return nil, WriteFileError.FormatErr(err)
-		}
-	}
-
-	result, err := e.vm.Run(fileName)
+	result, err := e.vm.Render(ctx, e.serverEntry, url, json.RawMessage(marshalledProps))
 	if err != nil {
 		return nil, ExecuteNodeJSCodeError.FormatErr(err)
 	}
@@ -160,8 +225,6 @@ func (e *ProductionEngine) Render(url string, props any) (*RenderResult, error)
 	html := addToHead(e.htmlTemplate, fmt.Sprintf(htmlInitialState, marshalledProps))
 	html = strings.Replace(html, "<div id=\"app\"></div>", fmt.Sprintf("<div id=\"app\">%s</div>", htmlValue), 1)
 
-	e.log.Info("Rendering HTML", "html", html)
-
 	if headValue != nil {
 		html = addToHead(html, headValue)
 	}
@@ -170,12 +233,38 @@ func (e *ProductionEngine) Render(url string, props any) (*RenderResult, error)
 		html = addToHead(html, fmt.Sprintf("<style>%s</style>", cssValue))
 	}
 
+	e.log.Debug("Rendered HTML", "url", url, "size", len(html))
+
 	return &RenderResult{
 		Content:     html,
 		ContentType: "text/html",
 	}, nil
 }
 
+func (e *ProductionEngine) Ready(ctx context.Context) error {
+	if err := e.vm.Ready(ctx); err != nil {
+		return NotReadyError.FormatErr(err)
+	}
+
+	return nil
+}
+
+func (e *ProductionEngine) Health(ctx context.Context) node.Health {
+	return e.vm.Health(ctx)
+}
+
+func (e *ProductionEngine) Stats() node.Stats {
+	return e.vm.Stats()
+}
+
+func (e *ProductionEngine) RegisterFunc(name string, fn node.Func) {
+	e.vm.RegisterFunc(name, fn)
+}
+
+func (e *ProductionEngine) Shutdown(ctx context.Context) error {
+	return e.vm.Shutdown(ctx)
+}
+
 func (e *ProductionEngine) Close() error {
 	return e.vm.Close()
 }
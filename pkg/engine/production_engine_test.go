@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestProductionEngineRender(t *testing.T) {
+	eng := newTestProductionEngine(t)
+
+	result, err := eng.RenderContext(context.Background(), "/users/7", map[string]any{"id": 7})
+	if err != nil {
+		t.Fatalf("could not render: %v", err)
+	}
+
+	for _, want := range []string{
+		`<div id="app"><p>/users/7</p></div>`,
+		`window.__INITIAL_STATE__ = {"id":7}`,
+		`<meta name="url" content="/users/7">`,
+	} {
+		if !strings.Contains(result.Content, want) {
+			t.Errorf("expected the page to contain %s, got %s", want, result.Content)
+		}
+	}
+
+	if n := strings.Count(result.Content, "</head>"); n != 1 {
+		t.Errorf("expected the page to close its head once, got %d times", n)
+	}
+
+	if result.ContentType != "text/html" {
+		t.Errorf("unexpected content type %q", result.ContentType)
+	}
+}
+
+func TestProductionEngineRenderDoesNotLogPages(t *testing.T) {
+	logs := &records{}
+
+	eng := newTestProductionEngine(t, ProductionEngineOptions{Logger: slog.New(logs)})
+
+	if _, err := eng.Render("/", map[string]any{"secret": "token"}); err != nil {
+		t.Fatalf("could not render: %v", err)
+	}
+
+	if messages := logs.atLeast(slog.LevelInfo); len(messages) > 0 {
+		t.Errorf("expected no logs at info level, got %v", messages)
+	}
+
+	logs.mutex.Lock()
+	defer logs.mutex.Unlock()
+
+	for _, record := range logs.records {
+		record.Attrs(func(attr slog.Attr) bool {
+			if strings.Contains(attr.Value.String(), "token") {
+				t.Errorf("expected the page not to be logged, got %s=%s", attr.Key, attr.Value)
+			}
+
+			return true
+		})
+	}
+}
+
+func TestProductionEngineLogsConsole(t *testing.T) {
+	logs := &records{}
+
+	eng := newTestProductionEngine(t, ProductionEngineOptions{Logger: slog.New(logs)})
+
+	if _, err := eng.Render("/", map[string]any{"log": "rendering users"}); err != nil {
+		t.Fatalf("could not render: %v", err)
+	}
+
+	found := false
+
+	for _, message := range logs.atLeast(slog.LevelInfo) {
+		if message == "rendering users" {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("expected the console call to be logged, got %v", logs.atLeast(slog.LevelInfo))
+	}
+}
@@ -0,0 +1,27 @@
+export async function render(props, url, page) {
+	if (props?.sleep) {
+		await new Promise((resolve) => setTimeout(resolve, props.sleep))
+	}
+	if (props?.loop) {
+		for (;;) {}
+	}
+	if (props?.throw) {
+		throw new Error(props.throw)
+	}
+	if (props?.log) {
+		console.info(props.log)
+	}
+	if (props?.fetch) {
+		const response = await fetch(props.fetch)
+
+		return { html: `<p>${response.status} ${await response.text()}</p>` }
+	}
+	if (props?.call) {
+		return { html: `<p>${JSON.stringify(await govite.call(props.call, props.args))}</p>` }
+	}
+
+	return {
+		html: `<p>${url}${page ? ` ${page.name} ${JSON.stringify(page.params)}` : ""}</p>`,
+		head: `<meta name="url" content="${url}">`,
+	}
+}
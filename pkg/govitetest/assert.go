@@ -0,0 +1,134 @@
+package govitetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// initialStateAssignment starts the script setting the props of the page.
+const initialStateAssignment = "window.__INITIAL_STATE__ ="
+
+// ErrNoInitialState is returned by InitialState for pages without props.
+var ErrNoInitialState = errors.New("govitetest: page has no initial state")
+
+// InitialState returns the JSON of the props injected into the rendered page
+// as window.__INITIAL_STATE__.
+func InitialState(html string) (json.RawMessage, error) {
+	_, rest, ok := strings.Cut(html, initialStateAssignment)
+	if !ok {
+		return nil, ErrNoInitialState
+	}
+
+	var state json.RawMessage
+	if err := json.NewDecoder(strings.NewReader(rest)).Decode(&state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Head returns the content of the head of the rendered page.
+func Head(html string) string {
+	start := strings.Index(html, "<head")
+	if start < 0 {
+		return ""
+	}
+
+	start += strings.Index(html[start:], ">") + 1
+
+	end := strings.Index(html[start:], "</head>")
+	if end < 0 {
+		return html[start:]
+	}
+
+	return html[start : start+end]
+}
+
+// AssertInitialState fails the test unless the props injected into the
+// rendered page are equal to want once both are encoded as JSON.
+func AssertInitialState(t testing.TB, html string, want any) {
+	t.Helper()
+
+	got, err := InitialState(html)
+	if err != nil {
+		t.Errorf("govitetest: could not read initial state: %v", err)
+
+		return
+	}
+
+	assertJSONEqual(t, "initial state", got, want)
+}
+
+// AssertProps fails the test unless the props of the render are equal to
+// want once both are encoded as JSON.
+func AssertProps(t testing.TB, render Render, want any) {
+	t.Helper()
+
+	got, err := json.Marshal(render.Props)
+	if err != nil {
+		t.Errorf("govitetest: could not marshal props of %s: %v", render.URL, err)
+
+		return
+	}
+
+	assertJSONEqual(t, "props of "+render.URL, got, want)
+}
+
+// AssertHeadContains fails the test unless the head of the rendered page
+// contains every tag. Runs of whitespace are compared as a single space.
+func AssertHeadContains(t testing.TB, html string, tags ...string) {
+	t.Helper()
+
+	head := collapseWhitespace(Head(html))
+
+	for _, tag := range tags {
+		if !strings.Contains(head, collapseWhitespace(tag)) {
+			t.Errorf("govitetest: head does not contain %s\nhead: %s", tag, head)
+		}
+	}
+}
+
+func assertJSONEqual(t testing.TB, name string, got json.RawMessage, want any) {
+	t.Helper()
+
+	wantJSON, err := json.Marshal(want)
+	if err != nil {
+		t.Errorf("govitetest: could not marshal expected %s: %v", name, err)
+
+		return
+	}
+
+	var gotValue, wantValue any
+
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Errorf("govitetest: %s is not JSON: %v", name, err)
+
+		return
+	}
+	if err := json.Unmarshal(wantJSON, &wantValue); err != nil {
+		t.Errorf("govitetest: could not unmarshal expected %s: %v", name, err)
+
+		return
+	}
+
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("govitetest: %s differ\ngot:  %s\nwant: %s", name, compact(got), wantJSON)
+	}
+}
+
+func compact(data json.RawMessage) string {
+	var buffer bytes.Buffer
+	if err := json.Compact(&buffer, data); err != nil {
+		return string(data)
+	}
+
+	return buffer.String()
+}
+
+func collapseWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
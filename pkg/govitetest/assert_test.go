@@ -0,0 +1,105 @@
+package govitetest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// failures records the errors of assertions instead of failing the test.
+type failures struct {
+	testing.TB
+	errors []string
+}
+
+func (f *failures) Helper() {}
+
+func (f *failures) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+const page = `<!doctype html>
+<html><head>
+  <title>Users</title>
+  <meta   name="description"
+    content="All users">
+<script>
+  window.__INITIAL_STATE__ = {"id": "7", "tags": ["a"]}
+</script>
+</head><body><div id="app"></div></body></html>`
+
+func TestInitialState(t *testing.T) {
+	state, err := InitialState(page)
+	if err != nil {
+		t.Fatalf("could not read initial state: %v", err)
+	}
+	if compact(state) != `{"id":"7","tags":["a"]}` {
+		t.Errorf("unexpected initial state %s", state)
+	}
+
+	if _, err := InitialState("<html></html>"); !errors.Is(err, ErrNoInitialState) {
+		t.Errorf("expected %v, got %v", ErrNoInitialState, err)
+	}
+}
+
+func TestHead(t *testing.T) {
+	tests := []struct {
+		html string
+		want string
+	}{
+		{html: `<html><head lang="en"><title>x</title></head></html>`, want: "<title>x</title>"},
+		{html: `<html><head><title>x</title>`, want: "<title>x</title>"},
+		{html: `<p>no head</p>`, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := Head(tt.html); got != tt.want {
+			t.Errorf("Head(%q) = %q, want %q", tt.html, got, tt.want)
+		}
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		name   string
+		assert func(t testing.TB)
+		fails  bool
+	}{
+		{name: "equal initial state", assert: func(t testing.TB) {
+			AssertInitialState(t, page, map[string]any{"tags": []string{"a"}, "id": "7"})
+		}},
+		{name: "different initial state", fails: true, assert: func(t testing.TB) {
+			AssertInitialState(t, page, map[string]any{"id": "8"})
+		}},
+		{name: "missing initial state", fails: true, assert: func(t testing.TB) {
+			AssertInitialState(t, "<html></html>", nil)
+		}},
+		{name: "equal props", assert: func(t testing.TB) {
+			AssertProps(t, Render{URL: "/", Props: struct {
+				ID int `json:"id"`
+			}{ID: 7}}, json.RawMessage(`{"id": 7}`))
+		}},
+		{name: "different props", fails: true, assert: func(t testing.TB) {
+			AssertProps(t, Render{URL: "/", Props: map[string]any{"id": 7}}, map[string]any{"id": "7"})
+		}},
+		{name: "head contains", assert: func(t testing.TB) {
+			AssertHeadContains(t, page, "<title>Users</title>", `<meta name="description" content="All users">`)
+		}},
+		{name: "head does not contain", fails: true, assert: func(t testing.TB) {
+			AssertHeadContains(t, page, "<title>Posts</title>")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &failures{TB: t}
+
+			tt.assert(f)
+
+			if failed := len(f.errors) > 0; failed != tt.fails {
+				t.Errorf("expected failure %v, got %v", tt.fails, f.errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+// Package govitetest provides utilities for testing applications that render
+// with govite.
+//
+// Engine is a fake engine.Engine for handler tests. It records every render
+// and answers with scripted results without starting node:
+//
+//	eng := govitetest.NewEngine()
+//	eng.SetResult("/users/7", nil, node.ErrOverloaded)
+//
+//	handler := router.New(eng)
+//	// ...
+//
+//	render, _ := eng.LastRender()
+//	govitetest.AssertProps(t, render, map[string]any{"id": "7"})
+//
+// NewProductionEngine starts a real engine against a built fixture for
+// integration tests, and Snapshot compares the pages it renders with golden
+// files under testdata:
+//
+//	eng := govitetest.NewProductionEngine(t, "testdata/dist")
+//	govitetest.Snapshot(t, eng, []govitetest.SnapshotCase{
+//		{URL: "/users/7", Props: map[string]any{"id": "7"}},
+//	})
+//
+// Run the tests with -govitetest.update to rewrite the golden files.
+package govitetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/lukeshay/govite/pkg/engine"
+	"github.com/lukeshay/govite/pkg/node"
+)
+
+// Render is a render recorded by Engine.
+type Render struct {
+	// Ctx is the context the render was made with.
+	Ctx context.Context
+	// URL is the URL that was rendered.
+	URL string
+	// Props are the props that were rendered.
+	Props any
+	// Request is the request passed to engine.WithRequest, if any.
+	Request *http.Request
+	// Page is the page passed to engine.WithPage, if any.
+	Page *node.Page
+}
+
+type result struct {
+	result *engine.RenderResult
+	err    error
+}
+
+// Engine is a fake engine.Engine recording every render. Renders of URLs
+// without a scripted result return a page with the props as its initial
+// state. Engine is safe for concurrent use.
+type Engine struct {
+	// RenderFunc, if set, answers the renders of URLs without a scripted
+	// result instead of the default page.
+	RenderFunc func(ctx context.Context, url string, props any) (*engine.RenderResult, error)
+	// StaticDir is returned by StaticPath.
+	StaticDir string
+
+	mutex   sync.Mutex
+	renders []Render
+	results map[string]result
+	closed  bool
+	funcs   node.Funcs
+}
+
+var _ engine.Engine = (*Engine)(nil)
+
+// NewEngine returns an Engine without scripted results.
+func NewEngine() *Engine {
+	return &Engine{results: map[string]result{}}
+}
+
+// SetResult scripts the result of the renders of url.
+func (e *Engine) SetResult(url string, renderResult *engine.RenderResult, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.results[url] = result{result: renderResult, err: err}
+}
+
+// Renders returns the renders recorded so far, in the order they were made.
+func (e *Engine) Renders() []Render {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return append([]Render(nil), e.renders...)
+}
+
+// LastRender returns the last recorded render, if any.
+func (e *Engine) LastRender() (Render, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if len(e.renders) == 0 {
+		return Render{}, false
+	}
+
+	return e.renders[len(e.renders)-1], true
+}
+
+// Reset forgets the recorded renders and the scripted results.
+func (e *Engine) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.renders = nil
+	e.results = map[string]result{}
+}
+
+func (e *Engine) Render(url string, props any) (*engine.RenderResult, error) {
+	return e.RenderContext(context.Background(), url, props)
+}
+
+func (e *Engine) RenderContext(ctx context.Context, url string, props any) (*engine.RenderResult, error) {
+	render := Render{Ctx: ctx, URL: url, Props: props}
+
+	if r, ok := node.RequestFromContext(ctx); ok {
+		render.Request = r
+	}
+	if page, ok := node.PageFromContext(ctx); ok {
+		render.Page = &page
+	}
+
+	e.mutex.Lock()
+	closed := e.closed
+	scripted, ok := e.results[url]
+	if !closed {
+		e.renders = append(e.renders, render)
+	}
+	e.mutex.Unlock()
+
+	switch {
+	case closed:
+		return nil, node.ErrShuttingDown
+	case ok:
+		return scripted.result, scripted.err
+	case e.RenderFunc != nil:
+		return e.RenderFunc(ctx, url, props)
+	default:
+		return DefaultResult(props)
+	}
+}
+
+// DefaultResult returns the page Engine renders for the props when there is
+// no scripted result, which has the props as its initial state.
+func DefaultResult(props any) (*engine.RenderResult, error) {
+	marshalledProps, err := json.Marshal(props)
+	if err != nil {
+		return nil, err
+	}
+
+	return &engine.RenderResult{
+		Content:     fmt.Sprintf("<!doctype html>\n<html><head><script>\n  window.__INITIAL_STATE__ = %s\n</script>\n</head><body><div id=\"app\"></div></body></html>\n", marshalledProps),
+		ContentType: "text/html",
+	}, nil
+}
+
+// Invoke calls the function registered under name with RegisterFunc, as
+// `govite.call(name, args)` would while rendering.
+func (e *Engine) Invoke(ctx context.Context, name string, args any) (any, error) {
+	marshalledArgs, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.funcs.Invoke(ctx, name, marshalledArgs)
+}
+
+func (e *Engine) Ready(ctx context.Context) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return engine.NotReadyError.FormatErr(node.ErrShuttingDown)
+	}
+
+	return nil
+}
+
+// Health reports a single worker that is ready until the engine is closed.
+func (e *Engine) Health(ctx context.Context) node.Health {
+	worker := node.WorkerHealth{ID: "fake", State: node.WorkerReady}
+
+	if err := e.Ready(ctx); err != nil {
+		worker.State = node.WorkerUnhealthy
+		worker.Error = err.Error()
+	}
+
+	return node.Health{
+		Healthy: worker.State == node.WorkerReady,
+		Workers: []node.WorkerHealth{worker},
+	}
+}
+
+func (e *Engine) Stats() node.Stats {
+	return node.Stats{Workers: []node.WorkerStats{{}}}
+}
+
+func (e *Engine) RegisterFunc(name string, fn node.Func) {
+	e.funcs.Register(name, fn)
+}
+
+// Shutdown closes the engine. Later renders return node.ErrShuttingDown.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	return e.Close()
+}
+
+// Close closes the engine. Later renders return node.ErrShuttingDown.
+func (e *Engine) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.closed = true
+
+	return nil
+}
+
+func (e *Engine) StaticPath() string {
+	return e.StaticDir
+}
@@ -0,0 +1,114 @@
+package govitetest_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lukeshay/govite/pkg/engine"
+	"github.com/lukeshay/govite/pkg/govitetest"
+	"github.com/lukeshay/govite/pkg/node"
+)
+
+func TestEngineRecordsRenders(t *testing.T) {
+	eng := govitetest.NewEngine()
+
+	r := httptest.NewRequest("GET", "/users/7", nil)
+	ctx := engine.WithPage(engine.WithRequest(context.Background(), r), node.Page{Name: "users/[id]", Params: map[string]string{"id": "7"}})
+
+	result, err := eng.RenderContext(ctx, "/users/7", map[string]any{"id": "7"})
+	if err != nil {
+		t.Fatalf("could not render: %v", err)
+	}
+
+	govitetest.AssertInitialState(t, result.Content, map[string]any{"id": "7"})
+
+	if _, err := eng.Render("/about", nil); err != nil {
+		t.Fatalf("could not render: %v", err)
+	}
+
+	renders := eng.Renders()
+	if len(renders) != 2 || renders[0].URL != "/users/7" || renders[1].URL != "/about" {
+		t.Fatalf("unexpected renders %+v", renders)
+	}
+
+	if renders[0].Request != r {
+		t.Error("expected the request to be recorded")
+	}
+	if renders[0].Page == nil || renders[0].Page.Params["id"] != "7" {
+		t.Errorf("expected the page to be recorded, got %+v", renders[0].Page)
+	}
+
+	govitetest.AssertProps(t, renders[0], map[string]any{"id": "7"})
+
+	if last, ok := eng.LastRender(); !ok || last.URL != "/about" {
+		t.Errorf("unexpected last render %+v", last)
+	}
+
+	eng.Reset()
+
+	if _, ok := eng.LastRender(); ok {
+		t.Error("expected no renders after Reset")
+	}
+}
+
+func TestEngineScriptedResults(t *testing.T) {
+	eng := govitetest.NewEngine()
+	eng.RenderFunc = func(ctx context.Context, url string, props any) (*engine.RenderResult, error) {
+		return &engine.RenderResult{Content: "func " + url}, nil
+	}
+
+	eng.SetResult("/overloaded", nil, node.ErrOverloaded)
+	eng.SetResult("/page", &engine.RenderResult{Content: "scripted"}, nil)
+
+	if _, err := eng.Render("/overloaded", nil); !errors.Is(err, node.ErrOverloaded) {
+		t.Errorf("expected the scripted error, got %v", err)
+	}
+	if result, _ := eng.Render("/page", nil); result.Content != "scripted" {
+		t.Errorf("expected the scripted result, got %v", result)
+	}
+	if result, _ := eng.Render("/other", nil); result.Content != "func /other" {
+		t.Errorf("expected the result of RenderFunc, got %v", result)
+	}
+}
+
+func TestEngineClose(t *testing.T) {
+	eng := govitetest.NewEngine()
+
+	if health := eng.Health(context.Background()); !health.Healthy {
+		t.Errorf("expected the engine to be healthy, got %+v", health)
+	}
+
+	if err := eng.Shutdown(context.Background()); err != nil {
+		t.Fatalf("could not shut down: %v", err)
+	}
+
+	if _, err := eng.Render("/", nil); !errors.Is(err, node.ErrShuttingDown) {
+		t.Errorf("expected %v, got %v", node.ErrShuttingDown, err)
+	}
+	if err := eng.Ready(context.Background()); !engine.NotReadyError.Is(err) {
+		t.Errorf("expected the engine not to be ready, got %v", err)
+	}
+	if health := eng.Health(context.Background()); health.Healthy || health.Workers[0].State != node.WorkerUnhealthy {
+		t.Errorf("expected the engine to be unhealthy, got %+v", health)
+	}
+	if renders := eng.Renders(); len(renders) != 0 {
+		t.Errorf("expected renders after close not to be recorded, got %+v", renders)
+	}
+}
+
+func TestEngineInvoke(t *testing.T) {
+	eng := govitetest.NewEngine()
+
+	eng.RegisterFunc("add", node.FuncOf(func(ctx context.Context, args []int) (int, error) {
+		return args[0] + args[1], nil
+	}))
+
+	if sum, err := eng.Invoke(context.Background(), "add", []int{2, 3}); err != nil || sum != 5 {
+		t.Errorf("expected 5, got %v, %v", sum, err)
+	}
+	if _, err := eng.Invoke(context.Background(), "missing", nil); !errors.Is(err, node.ErrUnknownFunc) {
+		t.Errorf("expected %v, got %v", node.ErrUnknownFunc, err)
+	}
+}
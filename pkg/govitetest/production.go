@@ -0,0 +1,101 @@
+package govitetest
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lukeshay/govite/pkg/engine"
+	"github.com/lukeshay/govite/pkg/utils/nodejs"
+)
+
+// NewProductionEngine starts a production engine rendering the build in
+// distDir, i.e. a fixture under testdata, and shuts it down when the test
+// finishes. The test is skipped with -short or when the runtime of the engine
+// is not installed.
+//
+// Unless they are set in options, the engine runs a single node process,
+// waits for it to be ready, and logs to the test.
+func NewProductionEngine(t testing.TB, distDir string, options ...engine.ProductionEngineOptions) engine.Engine {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("govitetest: skipping render with node in short mode")
+	}
+
+	option := engine.ProductionEngineOptions{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+
+	runtime := nodejs.DefaultRuntime(option.Runtime)
+	if _, err := exec.LookPath(runtime.Name()); err != nil {
+		t.Skipf("govitetest: %s is not installed: %v", runtime.Name(), err)
+	}
+
+	option.DistDir = distDir
+	option.WaitForReady = true
+
+	if option.NodeProcesses == 0 {
+		option.NodeProcesses = 1
+	}
+	if option.Logger == nil {
+		writer := &testWriter{t: t}
+
+		// Cleanups run last in first out, so the writer stops after the
+		// engine was shut down.
+		t.Cleanup(writer.stop)
+
+		option.Logger = slog.New(slog.NewTextHandler(writer, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	}
+
+	eng, err := engine.NewProductionEngine(option)
+	if err != nil {
+		t.Fatalf("govitetest: could not start production engine: %v", err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := eng.Shutdown(ctx); err != nil {
+			t.Logf("govitetest: could not shut down production engine: %v", err)
+		}
+	})
+
+	return eng
+}
+
+// testWriter writes every line to the log of the test until it is stopped.
+// Logging after the test finished panics.
+type testWriter struct {
+	mutex   sync.Mutex
+	t       testing.TB
+	stopped bool
+}
+
+func (w *testWriter) stop() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.stopped = true
+}
+
+func (w *testWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.stopped {
+		return len(p), nil
+	}
+
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+		w.t.Log(string(line))
+	}
+
+	return len(p), nil
+}
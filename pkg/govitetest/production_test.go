@@ -0,0 +1,28 @@
+package govitetest_test
+
+import (
+	"testing"
+
+	"github.com/lukeshay/govite/pkg/govitetest"
+)
+
+func TestNewProductionEngine(t *testing.T) {
+	eng := govitetest.NewProductionEngine(t, "testdata/dist")
+
+	result, err := eng.Render("/users/7", map[string]any{"name": "Ada"})
+	if err != nil {
+		t.Fatalf("could not render: %v", err)
+	}
+
+	govitetest.AssertInitialState(t, result.Content, map[string]any{"name": "Ada"})
+	govitetest.AssertHeadContains(t, result.Content, `<meta name="description" content="/users/7">`)
+}
+
+func TestSnapshot(t *testing.T) {
+	eng := govitetest.NewProductionEngine(t, "testdata/dist")
+
+	govitetest.Snapshot(t, eng, []govitetest.SnapshotCase{
+		{URL: "/"},
+		{URL: "/users/7", Props: map[string]any{"name": "Ada"}},
+	})
+}
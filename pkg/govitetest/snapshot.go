@@ -0,0 +1,326 @@
+package govitetest
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lukeshay/govite/pkg/engine"
+	"github.com/lukeshay/govite/pkg/router"
+)
+
+// update is namespaced, as packages often define an -update flag of their own.
+var update = flag.Bool("govitetest.update", false, "rewrite the golden files of govitetest.Snapshot")
+
+// SnapshotCase is a page rendered by Snapshot.
+type SnapshotCase struct {
+	// Name is the name of the subtest and of the golden file. Default is
+	// derived from the URL, i.e. "users_7" for "/users/7".
+	Name string
+	// URL is the URL that is rendered.
+	URL string
+	// Props are the props the URL is rendered with.
+	Props any
+}
+
+// SnapshotOptions for Snapshot
+type SnapshotOptions struct {
+	// Dir is the directory of the golden files. Default is
+	// "testdata/snapshots".
+	Dir string
+	// Manifest is the manifest of the client build, used to remove the hashes
+	// from the names of the assets it lists. Default is the manifest in the
+	// StaticPath of the engine, if there is one.
+	Manifest router.Manifest
+	// AssetsDir is the directory of the client build the hashed assets are
+	// emitted to, as build.assetsDir in the Vite config. The hashes are
+	// removed from the names of the files under it that are referenced by
+	// src, href and url(). Default is "assets".
+	AssetsDir string
+	// VolatileAttributes are the attributes whose values are replaced with
+	// "[volatile]". Default is nonce and integrity.
+	VolatileAttributes []string
+	// Normalize, if set, is applied to every page after the default
+	// normalization, i.e. to remove timestamps.
+	Normalize func(html string) string
+	// Update rewrites the golden files instead of comparing the pages with
+	// them. Default is the -govitetest.update flag.
+	Update bool
+}
+
+// hashedName matches the names Vite gives assets by default without their
+// extension, i.e. "index-BdF3k1x9" for "index-BdF3k1x9.js".
+var hashedName = regexp.MustCompile(`^(.+)-([A-Za-z0-9_-]{8})$`)
+
+// assetReference matches the values of src and href attributes and of url()
+// in stylesheets.
+var assetReference = regexp.MustCompile(`(\s(?:src|href)=["']?|url\(\s*["']?)([^"'\s()>]+)`)
+
+// volatileScripts match the values of the development pages that change
+// between projects, i.e. the HMR port picked automatically.
+var volatileScripts = regexp.MustCompile(`(window\.__HMR_PORT__ = )"[^"]*"`)
+
+// Snapshot renders every case with the engine, i.e. one returned by
+// NewProductionEngine, and compares the normalized page with its golden file.
+// Every case is rendered in a subtest when t is a *testing.T. Run the tests
+// with -govitetest.update to rewrite the golden files instead.
+//
+// Pages are normalized by removing the hashes from the names of the assets,
+// and replacing the values of volatile attributes.
+func Snapshot(t testing.TB, eng engine.Engine, cases []SnapshotCase, options ...SnapshotOptions) {
+	t.Helper()
+
+	option := SnapshotOptions{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+
+	if option.Dir == "" {
+		option.Dir = filepath.Join("testdata", "snapshots")
+	}
+	if *update {
+		option.Update = true
+	}
+	if option.Manifest == nil {
+		manifest, err := router.ReadManifest(eng.StaticPath())
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("govitetest: could not read manifest: %v", err)
+		}
+
+		option.Manifest = manifest
+	}
+
+	normalize := newNormalizer(option)
+
+	for _, c := range cases {
+		name := c.Name
+		if name == "" {
+			name = snapshotName(c.URL)
+		}
+
+		snapshot := func(t testing.TB) {
+			t.Helper()
+
+			result, err := eng.RenderContext(context.Background(), c.URL, c.Props)
+			if err != nil {
+				t.Fatalf("govitetest: could not render %s: %v", c.URL, err)
+			}
+
+			assertGolden(t, filepath.Join(option.Dir, name+".html"), normalize(result.Content), option.Update)
+		}
+
+		if parent, ok := t.(*testing.T); ok {
+			parent.Run(name, func(t *testing.T) { snapshot(t) })
+		} else {
+			snapshot(t)
+		}
+	}
+}
+
+// NormalizePage normalizes the page like Snapshot does.
+func NormalizePage(html string, options ...SnapshotOptions) string {
+	option := SnapshotOptions{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+
+	return newNormalizer(option)(html)
+}
+
+func newNormalizer(option SnapshotOptions) func(string) string {
+	if option.AssetsDir == "" {
+		option.AssetsDir = "assets"
+	}
+	if option.VolatileAttributes == nil {
+		option.VolatileAttributes = []string{"nonce", "integrity"}
+	}
+
+	assetsDir := strings.Trim(option.AssetsDir, "/")
+
+	var replacements []string
+
+	for _, file := range manifestFiles(option.Manifest) {
+		if normalized := unhash(file); normalized != file {
+			replacements = append(replacements, file, normalized)
+		}
+	}
+
+	assets := strings.NewReplacer(replacements...)
+
+	var volatile *regexp.Regexp
+	if len(option.VolatileAttributes) > 0 {
+		names := make([]string, len(option.VolatileAttributes))
+		for i, name := range option.VolatileAttributes {
+			names[i] = regexp.QuoteMeta(name)
+		}
+
+		volatile = regexp.MustCompile(`(\s(?:` + strings.Join(names, "|") + `)=)(?:"[^"]*"|'[^']*')`)
+	}
+
+	return func(html string) string {
+		html = assets.Replace(html)
+		html = assetReference.ReplaceAllStringFunc(html, func(reference string) string {
+			match := assetReference.FindStringSubmatch(reference)
+
+			return match[1] + unhashReference(match[2], assetsDir)
+		})
+		html = volatileScripts.ReplaceAllString(html, `$1"[volatile]"`)
+
+		if volatile != nil {
+			html = volatile.ReplaceAllString(html, `$1"[volatile]"`)
+		}
+
+		if option.Normalize != nil {
+			html = option.Normalize(html)
+		}
+
+		return html
+	}
+}
+
+// manifestFiles returns the files of every chunk in the manifest, the longest
+// first so that no file is replaced within another.
+func manifestFiles(manifest router.Manifest) []string {
+	seen := map[string]bool{}
+
+	var files []string
+
+	add := func(file string) {
+		if file != "" && !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, chunk := range manifest {
+		add(chunk.File)
+
+		for _, file := range chunk.CSS {
+			add(file)
+		}
+		for _, file := range chunk.Assets {
+			add(file)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if len(files[i]) != len(files[j]) {
+			return len(files[i]) > len(files[j])
+		}
+
+		return files[i] < files[j]
+	})
+
+	return files
+}
+
+// unhash replaces the hash of a file, which is the part of its name after the
+// last "-" if it has the 8 characters of the hashes of Vite, with "[hash]".
+// Words such as "settings" are kept, as hashes are base64 and all but never
+// only lowercase letters.
+func unhash(file string) string {
+	dir, base := path.Split(file)
+	ext := path.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+
+	match := hashedName.FindStringSubmatch(name)
+	if match == nil || !strings.ContainsFunc(match[2], func(r rune) bool { return r < 'a' || r > 'z' }) {
+		return file
+	}
+
+	return dir + match[1] + "-[hash]" + ext
+}
+
+// unhashReference unhashes the file referenced by the URL if it is in the
+// assets directory. The query and fragment of the URL are kept.
+func unhashReference(url string, assetsDir string) string {
+	file, suffix := url, ""
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		file, suffix = url[:i], url[i:]
+	}
+
+	dir := strings.TrimSuffix(path.Dir(file), "/")
+	if dir != assetsDir && !strings.HasSuffix(dir, "/"+assetsDir) {
+		return url
+	}
+
+	return unhash(file) + suffix
+}
+
+// snapshotName returns the name of the golden file of the URL.
+func snapshotName(url string) string {
+	name := strings.Trim(url, "/")
+	if name == "" {
+		return "index"
+	}
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// assertGolden compares got with the golden file, or rewrites the golden file
+// if update is set.
+func assertGolden(t testing.TB, golden string, got string, update bool) {
+	t.Helper()
+
+	if update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			t.Fatalf("govitetest: could not create %s: %v", filepath.Dir(golden), err)
+		}
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatalf("govitetest: could not write %s: %v", golden, err)
+		}
+
+		return
+	}
+
+	want, err := os.ReadFile(golden)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("govitetest: %s does not exist, run the test with -govitetest.update to create it", golden)
+	}
+	if err != nil {
+		t.Fatalf("govitetest: could not read %s: %v", golden, err)
+	}
+
+	if got != string(want) {
+		t.Errorf("govitetest: page differs from %s, run the test with -govitetest.update to accept it\n%s", golden, difference(got, string(want)))
+	}
+}
+
+// difference describes the first line that differs between got and want.
+func difference(got, want string) string {
+	gotLines := strings.Split(got, "\n")
+	wantLines := strings.Split(want, "\n")
+
+	for i := 0; i < max(len(gotLines), len(wantLines)); i++ {
+		var gotLine, wantLine string
+
+		if i < len(gotLines) {
+			gotLine = gotLines[i]
+		}
+		if i < len(wantLines) {
+			wantLine = wantLines[i]
+		}
+
+		if gotLine != wantLine {
+			return fmt.Sprintf("line %d:\ngot:  %s\nwant: %s", i+1, gotLine, wantLine)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,220 @@
+package govitetest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lukeshay/govite/pkg/engine"
+	"github.com/lukeshay/govite/pkg/router"
+)
+
+func TestNormalizePage(t *testing.T) {
+	manifest := router.Manifest{
+		"index.html": {File: "assets/index-BdF3k1x9.js", CSS: []string{"assets/index-Dk3m_a9Q.css"}},
+	}
+
+	tests := []struct {
+		name    string
+		html    string
+		options SnapshotOptions
+		want    string
+	}{
+		{
+			name:    "manifest files",
+			html:    `<script src="/assets/index-BdF3k1x9.js"></script><link href="/assets/index-Dk3m_a9Q.css">`,
+			options: SnapshotOptions{Manifest: manifest},
+			want:    `<script src="/assets/index-[hash].js"></script><link href="/assets/index-[hash].css">`,
+		},
+		{
+			name: "asset references",
+			html: `<img src="/assets/logo-a1B2c3D4.svg?v=1"><style>body { background: url('/assets/bg-Xy_9-zQ0.png') }</style>`,
+			want: `<img src="/assets/logo-[hash].svg?v=1"><style>body { background: url('/assets/bg-[hash].png') }</style>`,
+		},
+		{
+			name:    "assets dir",
+			html:    `<img src="/static/logo-a1B2c3D4.svg"><img src="/assets/logo-a1B2c3D4.svg">`,
+			options: SnapshotOptions{AssetsDir: "/static/"},
+			want:    `<img src="/static/logo-[hash].svg"><img src="/assets/logo-a1B2c3D4.svg">`,
+		},
+		{
+			name: "text",
+			html: `<p>Download user-settings.json</p>`,
+			want: `<p>Download user-settings.json</p>`,
+		},
+		{
+			name: "unhashed assets",
+			html: `<script src="/assets/my-page.js"></script><a href="/users/user-settings.json">`,
+			want: `<script src="/assets/my-page.js"></script><a href="/users/user-settings.json">`,
+		},
+		{
+			name: "volatile attributes",
+			html: `<script nonce="n0nc3" integrity='sha384-x'>0</script>`,
+			want: `<script nonce="[volatile]" integrity="[volatile]">0</script>`,
+		},
+		{
+			name:    "custom volatile attributes",
+			html:    `<div data-id="7" nonce="n0nc3"></div>`,
+			options: SnapshotOptions{VolatileAttributes: []string{"data-id"}},
+			want:    `<div data-id="[volatile]" nonce="n0nc3"></div>`,
+		},
+		{
+			name: "hmr port",
+			html: `<script>window.__HMR_PORT__ = "24678"</script>`,
+			want: `<script>window.__HMR_PORT__ = "[volatile]"</script>`,
+		},
+		{
+			name:    "normalize",
+			html:    `<p>2026-10-19</p>`,
+			options: SnapshotOptions{Normalize: func(html string) string { return strings.ReplaceAll(html, "2026-10-19", "[date]") }},
+			want:    `<p>[date]</p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizePage(tt.html, tt.options); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnhash(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"assets/index-BdF3k1x9.js", "assets/index-[hash].js"},
+		{"assets/vendor-react-Dk3m_a9Q.js", "assets/vendor-react-[hash].js"},
+		{"assets/index-BdF3k1x9", "assets/index-[hash]"},
+		{"assets/my-page.js", "assets/my-page.js"},
+		{"assets/user-settings.json", "assets/user-settings.json"},
+		{"assets/index.js", "assets/index.js"},
+		{"assets/vendor-abcdefgh.js", "assets/vendor-abcdefgh.js"},
+		{"assets/-BdF3k1x9.js", "assets/-BdF3k1x9.js"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			if got := unhash(tt.file); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestFiles(t *testing.T) {
+	manifest := router.Manifest{
+		"index.html": {
+			File:   "assets/index-BdF3k1x9.js",
+			CSS:    []string{"assets/index-Dk3m_a9Q.css"},
+			Assets: []string{"assets/logo-a1B2c3D4.svg"},
+		},
+		"src/pages/users.tsx": {File: "assets/users-Xy_9-zQ0.js", CSS: []string{"assets/index-Dk3m_a9Q.css"}},
+		"src/empty.ts":        {},
+	}
+
+	want := []string{
+		"assets/index-Dk3m_a9Q.css",
+		"assets/index-BdF3k1x9.js",
+		"assets/logo-a1B2c3D4.svg",
+		"assets/users-Xy_9-zQ0.js",
+	}
+
+	if got := manifestFiles(manifest); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSnapshotName(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"/", "index"},
+		{"", "index"},
+		{"/users", "users"},
+		{"/users/7/", "users_7"},
+		{"/search?q=a b", "search_q_a_b"},
+		{"/files/report-1.pdf", "files_report-1.pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := snapshotName(tt.url); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDifference(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+		diff string
+	}{
+		{"equal", "a\nb", "a\nb", ""},
+		{"changed line", "a\nb\nc", "a\nx\nc", "line 2:\ngot:  b\nwant: x"},
+		{"missing line", "a", "a\nb", "line 2:\ngot:  \nwant: b"},
+		{"extra line", "a\nb", "a", "line 2:\ngot:  b\nwant: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := difference(tt.got, tt.want); diff != tt.diff {
+				t.Errorf("got %q, want %q", diff, tt.diff)
+			}
+		})
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "snapshots", "index.html")
+
+	assertGolden(t, golden, "<p>a</p>", true)
+
+	content, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("golden file was not written: %v", err)
+	}
+	if string(content) != "<p>a</p>" {
+		t.Errorf("unexpected golden file %s", content)
+	}
+
+	f := &failures{TB: t}
+	assertGolden(f, golden, "<p>a</p>", false)
+	if len(f.errors) != 0 {
+		t.Errorf("unexpected failures %v", f.errors)
+	}
+
+	f = &failures{TB: t}
+	assertGolden(f, golden, "<p>b</p>", false)
+	if len(f.errors) != 1 || !strings.Contains(f.errors[0], "-govitetest.update") {
+		t.Errorf("expected a difference, got %v", f.errors)
+	}
+}
+
+func TestSnapshotWithoutSubtests(t *testing.T) {
+	eng := NewEngine()
+	dir := t.TempDir()
+	cases := []SnapshotCase{{URL: "/users/7", Props: map[string]any{"id": 7}}}
+
+	Snapshot(&failures{TB: t}, eng, cases, SnapshotOptions{Dir: dir, Update: true})
+
+	if _, err := os.Stat(filepath.Join(dir, "users_7.html")); err != nil {
+		t.Fatalf("golden file was not written: %v", err)
+	}
+
+	eng.SetResult("/users/7", &engine.RenderResult{Content: "<p>changed</p>", ContentType: "text/html"}, nil)
+
+	f := &failures{TB: t}
+	Snapshot(f, eng, cases, SnapshotOptions{Dir: dir})
+	if len(f.errors) != 1 || !strings.Contains(f.errors[0], "users_7.html") {
+		t.Errorf("expected a difference, got %v", f.errors)
+	}
+}
@@ -0,0 +1,6 @@
+export function render(props, url) {
+	return {
+		html: `<h1>${props?.name ?? url}</h1><p>Download user-settings.json</p>`,
+		head: `<meta name="description" content="${url}"><script nonce="n0nc3">0</script>`,
+	}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"expvar"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Publish publishes the metrics through expvar under the given name, so they
+// are served by the /debug/vars handler. Like expvar.Publish, it panics if the
+// name is already in use.
+func (m *Metrics) Publish(name string) {
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(m)
+
+	expvar.Publish(name, expvar.Func(func() any {
+		families, err := registry.Gather()
+		if err != nil {
+			return map[string]string{"error": err.Error()}
+		}
+
+		return snapshot(families)
+	}))
+}
+
+// snapshot converts the gathered metrics into a JSON friendly map. Counters
+// and gauges become their value and histograms their count and sum, keyed by
+// the values of their labels joined with ",".
+func snapshot(families []*dto.MetricFamily) map[string]any {
+	result := make(map[string]any, len(families))
+
+	for _, family := range families {
+		values := make(map[string]any, len(family.GetMetric()))
+
+		for _, metric := range family.GetMetric() {
+			labels := make([]string, 0, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetValue())
+			}
+
+			key := strings.Join(labels, ",")
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				values[key] = metric.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				values[key] = metric.GetGauge().GetValue()
+			case dto.MetricType_HISTOGRAM:
+				values[key] = map[string]any{
+					"count": metric.GetHistogram().GetSampleCount(),
+					"sum":   metric.GetHistogram().GetSampleSum(),
+				}
+			}
+		}
+
+		if len(values) == 1 {
+			if value, ok := values[""]; ok {
+				result[family.GetName()] = value
+				continue
+			}
+		}
+
+		result[family.GetName()] = values
+	}
+
+	return result
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/lukeshay/govite/pkg/node"
+)
+
+func TestPublish(t *testing.T) {
+	m := New()
+	m.ObserveRequest(node.RequestStats{Type: "render", Worker: -1, Err: &node.OverloadedError{}})
+	m.Publish("govite_test")
+
+	var vars map[string]map[string]any
+	if err := json.Unmarshal([]byte(expvar.Get("govite_test").String()), &vars); err != nil {
+		t.Fatalf("could not decode published metrics: %v", err)
+	}
+
+	if errors := vars["govite_errors_total"]["overloaded,render"]; errors != 1.0 {
+		t.Fatalf("expected 1 overloaded render, got %v in %v", errors, vars)
+	}
+}
@@ -0,0 +1,217 @@
+// Package metrics collects metrics about the renders and the worker pool of a
+// production engine. Metrics implements prometheus.Collector and can also be
+// published through expvar for services that do not use Prometheus.
+//
+//	m := metrics.New()
+//	eng := engine.MustNewProductionEngine(engine.ProductionEngineOptions{
+//		Observer: m,
+//	})
+//	m.Watch(eng)
+//	prometheus.MustRegister(m)
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/lukeshay/govite/pkg/node"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Source is the engine or VM whose queue and workers are reported.
+type Source interface {
+	Stats() node.Stats
+}
+
+// Options for Metrics
+type Options struct {
+	// Namespace is the prefix of every metric. Default is "govite".
+	Namespace string
+	// LatencyBuckets are the buckets of the queue wait and execution
+	// histograms in seconds. Default is prometheus.DefBuckets.
+	LatencyBuckets []float64
+	// SizeBuckets are the buckets of the result size histogram in bytes.
+	// Default is 1KiB to 4MiB in powers of 4.
+	SizeBuckets []float64
+}
+
+// Metrics is a node.Observer recording every request of the VM it is given
+// to, and a prometheus.Collector reporting them together with the state of
+// the workers of the watched Source.
+type Metrics struct {
+	mutex  sync.Mutex
+	source Source
+
+	queueWait  *prometheus.HistogramVec
+	execution  *prometheus.HistogramVec
+	resultSize *prometheus.HistogramVec
+	errors     *prometheus.CounterVec
+
+	queueDepth *prometheus.Desc
+	inFlight   *prometheus.Desc
+	restarts   *prometheus.Desc
+	recycles   *prometheus.Desc
+}
+
+var _ node.Observer = (*Metrics)(nil)
+var _ prometheus.Collector = (*Metrics)(nil)
+
+// New returns Metrics that are not watching any Source yet.
+func New(options ...Options) *Metrics {
+	option := Options{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+
+	if option.Namespace == "" {
+		option.Namespace = "govite"
+	}
+	if option.LatencyBuckets == nil {
+		option.LatencyBuckets = prometheus.DefBuckets
+	}
+	if option.SizeBuckets == nil {
+		option.SizeBuckets = prometheus.ExponentialBuckets(1<<10, 4, 7)
+	}
+
+	ns := option.Namespace
+
+	return &Metrics{
+		queueWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns,
+			Name:      "queue_wait_seconds",
+			Help:      "Time requests waited for a node worker.",
+			Buckets:   option.LatencyBuckets,
+		}, []string{"type"}),
+		execution: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns,
+			Name:      "execution_seconds",
+			Help:      "Time node workers took to answer requests.",
+			Buckets:   option.LatencyBuckets,
+		}, []string{"type"}),
+		resultSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns,
+			Name:      "result_bytes",
+			Help:      "Size of the results sent by node workers.",
+			Buckets:   option.SizeBuckets,
+		}, []string{"type"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "errors_total",
+			Help:      "Requests that failed, by the kind of error.",
+		}, []string{"type", "error"}),
+		queueDepth: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "", "queue_depth"),
+			"Requests waiting for a node worker.",
+			nil, nil,
+		),
+		inFlight: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "worker", "in_flight"),
+			"Requests sent to a node worker that were not answered yet.",
+			[]string{"worker"}, nil,
+		),
+		restarts: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "worker", "restarts_total"),
+			"Times a node worker was restarted after its process exited.",
+			[]string{"worker"}, nil,
+		),
+		recycles: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "worker", "recycles_total"),
+			"Times a node worker process was replaced after reaching a recycling limit.",
+			[]string{"worker"}, nil,
+		),
+	}
+}
+
+// Watch reports the queue and workers of the source. Only the last watched
+// source is reported.
+func (m *Metrics) Watch(source Source) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.source = source
+}
+
+func (m *Metrics) ObserveRequest(stats node.RequestStats) {
+	m.queueWait.WithLabelValues(stats.Type).Observe(stats.QueueWait.Seconds())
+
+	// Requests that were never scheduled did not execute.
+	if stats.Worker >= 0 {
+		m.execution.WithLabelValues(stats.Type).Observe(stats.Duration.Seconds())
+	}
+
+	if stats.Err != nil {
+		m.errors.WithLabelValues(stats.Type, ErrorKind(stats.Err)).Inc()
+
+		return
+	}
+
+	m.resultSize.WithLabelValues(stats.Type).Observe(float64(stats.ResultSize))
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.queueWait.Describe(ch)
+	m.execution.Describe(ch)
+	m.resultSize.Describe(ch)
+	m.errors.Describe(ch)
+
+	ch <- m.queueDepth
+	ch <- m.inFlight
+	ch <- m.restarts
+	ch <- m.recycles
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.queueWait.Collect(ch)
+	m.execution.Collect(ch)
+	m.resultSize.Collect(ch)
+	m.errors.Collect(ch)
+
+	m.mutex.Lock()
+	source := m.source
+	m.mutex.Unlock()
+
+	if source == nil {
+		return
+	}
+
+	stats := source.Stats()
+
+	ch <- prometheus.MustNewConstMetric(m.queueDepth, prometheus.GaugeValue, float64(stats.Queued))
+
+	for _, worker := range stats.Workers {
+		label := strconv.Itoa(worker.Worker)
+
+		ch <- prometheus.MustNewConstMetric(m.inFlight, prometheus.GaugeValue, float64(worker.InFlight), label)
+		ch <- prometheus.MustNewConstMetric(m.restarts, prometheus.CounterValue, float64(worker.Restarts), label)
+		ch <- prometheus.MustNewConstMetric(m.recycles, prometheus.CounterValue, float64(worker.Recycles), label)
+	}
+}
+
+// ErrorKind classifies the error of a request for the "error" label.
+func ErrorKind(err error) string {
+	var runtimeErr *node.RuntimeError
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, node.ErrOverloaded):
+		return "overloaded"
+	case errors.Is(err, node.ErrRenderTimeout):
+		return "render_timeout"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, node.ErrWorkerExited):
+		return "worker_exited"
+	case errors.Is(err, net.ErrClosed):
+		return "closed"
+	case errors.As(err, &runtimeErr):
+		return runtimeErr.Code
+	default:
+		return "other"
+	}
+}
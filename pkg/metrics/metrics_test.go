@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/lukeshay/govite/pkg/node"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type source struct {
+	stats node.Stats
+}
+
+func (s source) Stats() node.Stats {
+	return s.stats
+}
+
+// sampleCount returns the number of observations of the histogram.
+func sampleCount(t *testing.T, m *Metrics, name string) uint64 {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count uint64
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			count += metric.GetHistogram().GetSampleCount()
+		}
+	}
+
+	return count
+}
+
+func TestObserveRequest(t *testing.T) {
+	m := New()
+
+	m.ObserveRequest(node.RequestStats{Type: "render", Worker: 0, ResultSize: 2048})
+	m.ObserveRequest(node.RequestStats{Type: "render", Worker: 1, Err: &node.RuntimeError{Code: "exception"}})
+	m.ObserveRequest(node.RequestStats{Type: "render", Worker: -1, Err: &node.OverloadedError{Reason: "queue full"}})
+	// A request that was never scheduled but did not fail is not an error.
+	m.ObserveRequest(node.RequestStats{Type: "render", Worker: -1})
+
+	if count := testutil.CollectAndCount(m.queueWait); count != 1 {
+		t.Errorf("expected 1 queue wait histogram, got %d", count)
+	}
+
+	expected := `
+# HELP govite_errors_total Requests that failed, by the kind of error.
+# TYPE govite_errors_total counter
+govite_errors_total{error="exception",type="render"} 1
+govite_errors_total{error="overloaded",type="render"} 1
+`
+
+	if err := testutil.CollectAndCompare(m.errors, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	if count := sampleCount(t, m, "govite_execution_seconds"); count != 2 {
+		t.Errorf("expected 2 executions, got %d", count)
+	}
+	if count := sampleCount(t, m, "govite_result_bytes"); count != 2 {
+		t.Errorf("expected 2 results, got %d", count)
+	}
+}
+
+func TestCollectWorkers(t *testing.T) {
+	m := New()
+
+	m.Watch(source{stats: node.Stats{
+		Queued: 3,
+		Workers: []node.WorkerStats{
+			{Worker: 0, InFlight: 2, Restarts: 1},
+			{Worker: 1, Recycles: 4},
+		},
+	}})
+
+	expected := `
+# HELP govite_queue_depth Requests waiting for a node worker.
+# TYPE govite_queue_depth gauge
+govite_queue_depth 3
+# HELP govite_worker_in_flight Requests sent to a node worker that were not answered yet.
+# TYPE govite_worker_in_flight gauge
+govite_worker_in_flight{worker="0"} 2
+govite_worker_in_flight{worker="1"} 0
+# HELP govite_worker_recycles_total Times a node worker process was replaced after reaching a recycling limit.
+# TYPE govite_worker_recycles_total counter
+govite_worker_recycles_total{worker="0"} 0
+govite_worker_recycles_total{worker="1"} 4
+`
+
+	if err := testutil.CollectAndCompare(m, strings.NewReader(expected), "govite_queue_depth", "govite_worker_in_flight", "govite_worker_recycles_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind string
+	}{
+		{nil, ""},
+		{&node.OverloadedError{Reason: "queue timeout"}, "overloaded"},
+		{&node.RenderTimeoutError{}, "render_timeout"},
+		{context.DeadlineExceeded, "timeout"},
+		{fmt.Errorf("render: %w", context.Canceled), "canceled"},
+		{&node.WorkerExitError{Err: net.ErrClosed}, "worker_exited"},
+		{net.ErrClosed, "closed"},
+		{&node.RuntimeError{Code: "exception"}, "exception"},
+		{fmt.Errorf("other"), "other"},
+	}
+
+	for _, test := range tests {
+		if kind := ErrorKind(test.err); kind != test.kind {
+			t.Errorf("ErrorKind(%v) = %q, expected %q", test.err, kind, test.kind)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/lukeshay/govite/internal/protocol"
+)
+
+type requestKey struct{}
+
+// WithRequest returns a context carrying the request that is being rendered.
+// Fetches made while rendering with the context are resolved against its
+// origin and carry its cookies.
+func WithRequest(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, r)
+}
+
+// RequestFromContext returns the request passed to WithRequest, if any.
+func RequestFromContext(ctx context.Context) (*http.Request, bool) {
+	r, ok := ctx.Value(requestKey{}).(*http.Request)
+
+	return r, ok
+}
+
+// defaultOrigin is the origin of renders without a request.
+const defaultOrigin = "http://localhost"
+
+// Origin returns the origin of the request in ctx, i.e. "https://example.com",
+// or "http://localhost" if there is none.
+func Origin(ctx context.Context) string {
+	r, ok := RequestFromContext(ctx)
+	if !ok || r.Host == "" {
+		return defaultOrigin
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
+
+// FetchRequest is a fetch made while rendering that is served by the handler
+// of the VM or engine.
+type FetchRequest struct {
+	// Request is the ID of the request the fetch was made in, if any.
+	Request string      `json:"request"`
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers [][2]string `json:"headers"`
+	Body    []byte      `json:"body,omitempty"`
+}
+
+// FetchResponse is the response of the handler to a FetchRequest.
+type FetchResponse struct {
+	Status  int         `json:"status"`
+	Headers [][2]string `json:"headers"`
+	Body    []byte      `json:"body,omitempty"`
+}
+
+// ServeFetch serves the fetch with the handler in-process. The request gets
+// ctx as its context, and the cookies of the request in ctx unless the fetch
+// sets its own.
+func ServeFetch(ctx context.Context, handler http.Handler, fetch FetchRequest) (response *FetchResponse, err error) {
+	target, err := url.Parse(fetch.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := http.NewRequestWithContext(ctx, fetch.Method, target.String(), bytes.NewReader(fetch.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, header := range fetch.Headers {
+		r.Header.Add(header[0], header[1])
+	}
+
+	if original, ok := RequestFromContext(ctx); ok && r.Header.Get("Cookie") == "" {
+		for _, cookie := range original.Header.Values("Cookie") {
+			r.Header.Add("Cookie", cookie)
+		}
+	}
+
+	r.RequestURI = target.RequestURI()
+	r.RemoteAddr = "127.0.0.1:0"
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("handler panicked serving %s %s: %v", fetch.Method, target.Path, recovered)
+		}
+	}()
+
+	recorder := httptest.NewRecorder()
+
+	handler.ServeHTTP(recorder, r)
+
+	result := recorder.Result()
+
+	response = &FetchResponse{
+		Status: result.StatusCode,
+		Body:   recorder.Body.Bytes(),
+	}
+
+	for name, values := range result.Header {
+		for _, value := range values {
+			response.Headers = append(response.Headers, [2]string{name, value})
+		}
+	}
+
+	return response, nil
+}
+
+// fetch answers a fetch made by the worker of the connection with the handler
+// of the options.
+func (vm *nodeJsVM) fetch(connection *vmConnection, frame protocol.Frame) {
+	var fetch FetchRequest
+	if err := frame.Decode(&fetch); err != nil {
+		vm.reply(connection, protocol.NewErrorFrame(frame.ID, &protocol.Error{
+			Code:    protocol.CodeInvalidFrame,
+			Message: err.Error(),
+		}))
+
+		return
+	}
+
+	if vm.options.Handler == nil {
+		vm.reply(connection, protocol.NewErrorFrame(frame.ID, &protocol.Error{
+			Code:    protocol.CodeUnknownType,
+			Message: "the VM has no handler for fetches",
+		}))
+
+		return
+	}
+
+	ctx := context.Background()
+	if pending, ok := vm.pending.Load(fetch.Request); ok {
+		ctx = pending.(*pendingRequest).ctx
+	}
+
+	response, err := ServeFetch(ctx, vm.options.Handler, fetch)
+	if err != nil {
+		connection.log.Debug("Fetch failed", "url", fetch.URL, "request", fetch.Request, "error", err)
+
+		vm.reply(connection, protocol.NewErrorFrame(frame.ID, &protocol.Error{
+			Code:    protocol.CodeException,
+			Message: err.Error(),
+		}))
+
+		return
+	}
+
+	result, _ := protocol.NewFrame(frame.ID, protocol.TypeResult, response)
+
+	vm.reply(connection, result)
+}
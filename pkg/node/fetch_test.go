@@ -0,0 +1,106 @@
+package node
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOrigin(t *testing.T) {
+	secure := httptest.NewRequest(http.MethodGet, "https://example.com/users", nil)
+	secure.TLS = &tls.ConnectionState{}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "without request", ctx: context.Background(), want: "http://localhost"},
+		{name: "http", ctx: WithRequest(context.Background(), httptest.NewRequest(http.MethodGet, "http://example.com:8080/", nil)), want: "http://example.com:8080"},
+		{name: "https", ctx: WithRequest(context.Background(), secure), want: "https://example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Origin(tt.ctx); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeFetch(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+
+		w.Header().Set("X-Cookie", r.Header.Get("Cookie"))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(r.Method + " " + r.RequestURI))
+	})
+
+	original := httptest.NewRequest(http.MethodGet, "/", nil)
+	original.Header.Set("Cookie", "session=1")
+
+	ctx := WithRequest(context.Background(), original)
+
+	response, err := ServeFetch(ctx, handler, FetchRequest{Method: http.MethodPost, URL: "http://localhost/users?page=2"})
+	if err != nil {
+		t.Fatalf("could not serve fetch: %v", err)
+	}
+	if response.Status != http.StatusCreated || string(response.Body) != "POST /users?page=2" {
+		t.Errorf("unexpected response %d %s", response.Status, response.Body)
+	}
+	if cookie := header(response.Headers, "X-Cookie"); cookie != "session=1" {
+		t.Errorf("expected the cookies of the request, got %q", cookie)
+	}
+
+	response, err = ServeFetch(ctx, handler, FetchRequest{Method: http.MethodGet, URL: "http://localhost/", Headers: [][2]string{{"Cookie", "session=2"}}})
+	if err != nil {
+		t.Fatalf("could not serve fetch: %v", err)
+	}
+	if cookie := header(response.Headers, "X-Cookie"); cookie != "session=2" {
+		t.Errorf("expected the cookies of the fetch, got %q", cookie)
+	}
+
+	if _, err := ServeFetch(ctx, handler, FetchRequest{Method: http.MethodGet, URL: "http://localhost/panic"}); err == nil {
+		t.Error("expected an error for a panicking handler")
+	}
+}
+
+func TestFetchBridge(t *testing.T) {
+	vm := newTestVM(t, Options{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + " " + r.URL.Path + " " + r.Header.Get("Cookie")))
+	})})
+
+	original := httptest.NewRequest(http.MethodGet, "http://example.com/users", nil)
+	original.Header.Set("Cookie", "session=1")
+
+	ctx := WithRequest(context.Background(), original)
+
+	for _, url := range []string{"/api/users", "http://example.com/api/users"} {
+		result, err := vm.Render(ctx, testEntry(t), "/users", map[string]any{"fetch": url})
+		if err != nil {
+			t.Fatalf("could not fetch %s: %v", url, err)
+		}
+
+		response := result.(map[string]any)
+		if response["status"] != float64(200) || response["body"] != "example.com /api/users session=1" {
+			t.Errorf("unexpected response to %s: %v", url, response)
+		}
+	}
+}
+
+// header returns the first value of the named header.
+func header(headers [][2]string, name string) string {
+	for _, header := range headers {
+		if header[0] == name {
+			return header[1]
+		}
+	}
+
+	return ""
+}
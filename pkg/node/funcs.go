@@ -0,0 +1,142 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lukeshay/govite/internal/protocol"
+)
+
+// ErrUnknownFunc is matched by the errors of calls to functions that were not
+// registered.
+var ErrUnknownFunc = errors.New("unknown func")
+
+// Func is a Go function that Javascript calls with
+// `await govite.call(name, args)`. ctx is the context of the request the call
+// was made in and is canceled once the request is done. The result is encoded
+// as JSON.
+type Func func(ctx context.Context, args json.RawMessage) (any, error)
+
+// FuncOf returns a Func decoding its arguments into Args.
+func FuncOf[Args any, Result any](fn func(ctx context.Context, args Args) (Result, error)) Func {
+	return func(ctx context.Context, raw json.RawMessage) (any, error) {
+		var args Args
+
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return nil, fmt.Errorf("invalid arguments: %w", err)
+			}
+		}
+
+		return fn(ctx, args)
+	}
+}
+
+// Funcs is a registry of the Funcs callable from Javascript. The zero value is
+// ready to use.
+type Funcs struct {
+	funcs sync.Map
+}
+
+// Register registers fn under name, replacing the Func registered before.
+func (f *Funcs) Register(name string, fn Func) {
+	f.funcs.Store(name, fn)
+}
+
+// Invoke calls the Func registered under name. A panicking Func returns an
+// error.
+func (f *Funcs) Invoke(ctx context.Context, name string, args json.RawMessage) (value any, err error) {
+	fn, ok := f.funcs.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownFunc, name)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("func %q panicked: %v", name, r)
+		}
+	}()
+
+	return fn.(Func)(ctx, args)
+}
+
+// FuncError returns the error sent to Javascript for the error of a Func.
+func FuncError(err error) *RuntimeError {
+	code := protocol.CodeException
+	if errors.Is(err, ErrUnknownFunc) {
+		code = protocol.CodeUnknownFunc
+	}
+
+	return &RuntimeError{Code: code, Message: err.Error()}
+}
+
+type vmInvokeContent struct {
+	// Request is the ID of the request the call was made in, if any.
+	Request string          `json:"request"`
+	Name    string          `json:"name"`
+	Args    json.RawMessage `json:"args"`
+}
+
+// RegisterFunc makes fn callable from Javascript as
+// `await govite.call(name, args)`.
+func (vm *nodeJsVM) RegisterFunc(name string, fn Func) {
+	vm.funcs.Register(name, fn)
+}
+
+// serveWorker answers a request made by the worker of the connection.
+func (vm *nodeJsVM) serveWorker(connection *vmConnection, frame protocol.Frame) {
+	switch frame.Type {
+	case protocol.TypeInvoke:
+		vm.invoke(connection, frame)
+	case protocol.TypeFetch:
+		vm.fetch(connection, frame)
+	}
+}
+
+// invoke answers a call to a Func made by the worker of the connection.
+func (vm *nodeJsVM) invoke(connection *vmConnection, frame protocol.Frame) {
+	var content vmInvokeContent
+	if err := frame.Decode(&content); err != nil {
+		vm.reply(connection, protocol.NewErrorFrame(frame.ID, &protocol.Error{
+			Code:    protocol.CodeInvalidFrame,
+			Message: err.Error(),
+		}))
+
+		return
+	}
+
+	ctx := context.Background()
+	if pending, ok := vm.pending.Load(content.Request); ok {
+		ctx = pending.(*pendingRequest).ctx
+	}
+
+	ctx, end := vm.startSpan(ctx, "govite.func."+content.Name, nil)
+
+	value, err := vm.funcs.Invoke(ctx, content.Name, content.Args)
+
+	end(err)
+
+	if err != nil {
+		connection.log.Debug("Func failed", "name", content.Name, "request", content.Request, "error", err)
+
+		vm.reply(connection, protocol.NewErrorFrame(frame.ID, FuncError(err)))
+
+		return
+	}
+
+	result, err := protocol.NewFrame(frame.ID, protocol.TypeResult, value)
+	if err != nil {
+		result = protocol.NewErrorFrame(frame.ID, FuncError(err))
+	}
+
+	vm.reply(connection, result)
+}
+
+func (vm *nodeJsVM) reply(connection *vmConnection, frame protocol.Frame) {
+	if err := connection.writer.WriteFrame(frame); err != nil {
+		connection.log.Debug("Error replying to worker", "id", frame.ID, "error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lukeshay/govite/internal/protocol"
+)
+
+type contextKey struct{}
+
+func TestFuncsInvoke(t *testing.T) {
+	var funcs Funcs
+
+	funcs.Register("greet", FuncOf(func(ctx context.Context, args struct{ Name string }) (string, error) {
+		return "hello " + args.Name, nil
+	}))
+	funcs.Register("panic", func(context.Context, json.RawMessage) (any, error) {
+		panic("boom")
+	})
+
+	tests := []struct {
+		name    string
+		fn      string
+		args    string
+		want    any
+		wantErr string
+	}{
+		{name: "decodes arguments", fn: "greet", args: `{"Name":"govite"}`, want: "hello govite"},
+		{name: "without arguments", fn: "greet", want: "hello "},
+		{name: "invalid arguments", fn: "greet", args: `[1]`, wantErr: "invalid arguments"},
+		{name: "unknown", fn: "missing", wantErr: `unknown func "missing"`},
+		{name: "panic", fn: "panic", wantErr: `func "panic" panicked: boom`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := funcs.Invoke(context.Background(), tt.fn, json.RawMessage(tt.args))
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("could not invoke: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFuncError(t *testing.T) {
+	if code := FuncError(errors.New("boom")).Code; code != protocol.CodeException {
+		t.Errorf("expected %s, got %s", protocol.CodeException, code)
+	}
+	if code := FuncError(ErrUnknownFunc).Code; code != protocol.CodeUnknownFunc {
+		t.Errorf("expected %s, got %s", protocol.CodeUnknownFunc, code)
+	}
+}
+
+func TestGoviteCall(t *testing.T) {
+	vm := newTestVM(t)
+
+	vm.RegisterFunc("user", FuncOf(func(ctx context.Context, args struct{ ID int }) (map[string]any, error) {
+		return map[string]any{"id": args.ID, "request": ctx.Value(contextKey{})}, nil
+	}))
+	vm.RegisterFunc("fail", func(context.Context, json.RawMessage) (any, error) {
+		return nil, errors.New("not allowed")
+	})
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "request-1")
+
+	result, err := vm.Call(ctx, "./entry.js", "call", "user", map[string]any{"ID": 7})
+	if err != nil {
+		t.Fatalf("could not call: %v", err)
+	}
+
+	user := result.(map[string]any)
+	if user["id"] != float64(7) || user["request"] != "request-1" {
+		t.Errorf("unexpected result %v", user)
+	}
+
+	var runtimeErr *RuntimeError
+
+	if _, err := vm.Call(ctx, "./entry.js", "call", "fail", nil); !errors.As(err, &runtimeErr) || !strings.Contains(runtimeErr.Message, "not allowed") {
+		t.Errorf("expected the error of the func, got %v", err)
+	}
+	if code, err := vm.Call(ctx, "./entry.js", "code", "missing", nil); err != nil || code != protocol.CodeUnknownFunc {
+		t.Errorf("expected %s, got %v, %v", protocol.CodeUnknownFunc, code, err)
+	}
+}
@@ -0,0 +1,137 @@
+package node
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lukeshay/govite/internal/protocol"
+)
+
+// handshakeTimeout is the time a worker has to authenticate after connecting.
+// It is read when a VM is created.
+var handshakeTimeout = 10 * time.Second
+
+// ErrUnauthenticated is matched by the errors of connections that were
+// rejected because they did not authenticate as a worker of the VM.
+var ErrUnauthenticated = errors.New("node worker failed to authenticate")
+
+// vmHandshake is the content of the hello frame every worker sends first.
+// Worker and Token are given to the worker through the GOVITE_WORKER_ID and
+// GOVITE_TOKEN environment variables when its process is started.
+type vmHandshake struct {
+	Versions []int  `json:"versions"`
+	PID      int    `json:"pid"`
+	Runtime  string `json:"runtime"`
+	Worker   string `json:"worker"`
+	Token    string `json:"token"`
+}
+
+type vmWelcome struct {
+	Version int `json:"version"`
+}
+
+func newToken() (string, error) {
+	token := make([]byte, 32)
+
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
+
+// authenticate reads the hello frame of the connection, answers it and
+// returns the process the connection belongs to. If expected is not nil, the
+// connection must belong to it. Every process can only authenticate a single
+// connection.
+func (vm *nodeJsVM) authenticate(connection *vmConnection, expected *process) (*process, error) {
+	connection.Conn.SetReadDeadline(time.Now().Add(vm.handshakeTimeout))
+	defer connection.Conn.SetReadDeadline(time.Time{})
+
+	hello, err := connection.ReadFrame()
+	if err != nil && !errors.Is(err, protocol.ErrInvalidFrame) {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+
+	p, err := vm.verifyHello(hello, err, expected)
+	if err != nil {
+		code := protocol.CodeUnauthenticated
+
+		var protocolErr *protocol.Error
+		if errors.As(err, &protocolErr) {
+			code = protocolErr.Code
+		}
+
+		connection.writer.WriteFrame(protocol.NewErrorFrame(hello.ID, &protocol.Error{
+			Code:    code,
+			Message: err.Error(),
+		}))
+
+		return nil, err
+	}
+
+	welcome, err := protocol.NewFrame(hello.ID, protocol.TypeWelcome, vmWelcome{Version: protocol.Version})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := connection.writer.WriteFrame(welcome); err != nil {
+		return nil, err
+	}
+
+	connection.Initialize(p.PID())
+
+	return p, nil
+}
+
+func (vm *nodeJsVM) verifyHello(hello protocol.Frame, err error, expected *process) (*process, error) {
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+
+	if hello.Type != protocol.TypeHello {
+		return nil, fmt.Errorf("%w: expected hello, got %q", ErrUnauthenticated, hello.Type)
+	}
+
+	var handshake vmHandshake
+	if err := hello.Decode(&handshake); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+
+	if !slices.Contains(handshake.Versions, protocol.Version) {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthenticated, &protocol.Error{
+			Code:    protocol.CodeUnsupportedVersion,
+			Message: fmt.Sprintf("worker supports protocol versions %v, not %d", handshake.Versions, protocol.Version),
+		})
+	}
+
+	value, ok := vm.processes.Load(handshake.Worker)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown worker %q", ErrUnauthenticated, handshake.Worker)
+	}
+
+	p := value.(*process)
+
+	if subtle.ConstantTimeCompare([]byte(handshake.Token), []byte(p.token)) != 1 {
+		return nil, fmt.Errorf("%w: invalid token for worker %q", ErrUnauthenticated, handshake.Worker)
+	}
+
+	if expected != nil && p != expected {
+		return nil, fmt.Errorf("%w: connection belongs to worker %q", ErrUnauthenticated, expected.id)
+	}
+
+	if handshake.PID != p.PID() {
+		return nil, fmt.Errorf("%w: worker %q has pid %d, not %d", ErrUnauthenticated, handshake.Worker, p.PID(), handshake.PID)
+	}
+
+	if !vm.processes.CompareAndDelete(handshake.Worker, p) {
+		return nil, fmt.Errorf("%w: worker %q is already connected", ErrUnauthenticated, handshake.Worker)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,99 @@
+package node
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/lukeshay/govite/internal/protocol"
+)
+
+// hello connects to the transport of the VM, says hello with the handshake
+// and returns the answer of the VM.
+func hello(t *testing.T, vm *nodeJsVM, handshake vmHandshake) protocol.Frame {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", vm.transport.(*listenerTransport).address)
+	if err != nil {
+		t.Fatalf("could not connect to VM: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	frame, err := protocol.NewFrame("hello-1", protocol.TypeHello, handshake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := protocol.NewWriter(conn).WriteFrame(frame); err != nil {
+		t.Fatalf("could not send hello: %v", err)
+	}
+
+	answer, err := protocol.NewReader(conn).ReadFrame()
+	if err != nil {
+		t.Fatalf("could not read answer: %v", err)
+	}
+
+	return answer
+}
+
+func TestHandshakeRejectsStrangers(t *testing.T) {
+	vm := newTestVM(t)
+
+	// A process that was started but did not connect yet.
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &process{id: "pending", token: "secret", worker: vm.workers[0], cmd: &exec.Cmd{Process: self}}
+
+	vm.processes.Store(p.id, p)
+
+	tests := map[string]struct {
+		handshake vmHandshake
+		code      string
+	}{
+		"unknown worker": {
+			handshake: vmHandshake{Versions: []int{protocol.Version}, Worker: "unknown", Token: p.token, PID: p.PID()},
+			code:      protocol.CodeUnauthenticated,
+		},
+		"invalid token": {
+			handshake: vmHandshake{Versions: []int{protocol.Version}, Worker: p.id, Token: "invalid", PID: p.PID()},
+			code:      protocol.CodeUnauthenticated,
+		},
+		"other pid": {
+			handshake: vmHandshake{Versions: []int{protocol.Version}, Worker: p.id, Token: p.token, PID: 1},
+			code:      protocol.CodeUnauthenticated,
+		},
+		"unsupported version": {
+			handshake: vmHandshake{Versions: []int{protocol.Version + 1}, Worker: p.id, Token: p.token, PID: p.PID()},
+			code:      protocol.CodeUnsupportedVersion,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			answer := hello(t, vm, test.handshake)
+
+			if answer.Type != protocol.TypeError || answer.Error == nil || answer.Error.Code != test.code {
+				t.Fatalf("expected a %s error, got %+v", test.code, answer)
+			}
+		})
+	}
+}
+
+func TestHandshakeRejectsConnectedWorkers(t *testing.T) {
+	vm := newTestVM(t)
+
+	p := vm.workers[0].Process()
+
+	answer := hello(t, vm, vmHandshake{Versions: []int{protocol.Version}, Worker: p.id, Token: p.token, PID: p.PID()})
+
+	if answer.Type != protocol.TypeError || answer.Error.Code != protocol.CodeUnauthenticated {
+		t.Fatalf("expected an unauthenticated error, got %+v", answer)
+	}
+}
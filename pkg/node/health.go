@@ -0,0 +1,198 @@
+package node
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lukeshay/govite/internal/protocol"
+	"github.com/rs/xid"
+)
+
+// WorkerState is the state of a single worker of the VM.
+type WorkerState string
+
+const (
+	// WorkerStarting means the worker process is running but has not connected
+	// and initialized yet.
+	WorkerStarting WorkerState = "starting"
+	// WorkerReady means the worker answered a ping.
+	WorkerReady WorkerState = "ready"
+	// WorkerUnhealthy means the worker is connected but did not answer a ping.
+	WorkerUnhealthy WorkerState = "unhealthy"
+	// WorkerRestarting means the worker process exited and is waiting to be
+	// restarted.
+	WorkerRestarting WorkerState = "restarting"
+)
+
+// WorkerHealth is the health of a single worker of the VM.
+type WorkerHealth struct {
+	// ID is the ID of the worker's connection. It is empty while the worker is
+	// starting.
+	ID string `json:"id"`
+	// PID is the process ID of the worker.
+	PID int `json:"pid"`
+	// State is the state of the worker.
+	State WorkerState `json:"state"`
+	// Latency is the round trip time of the ping sent to the worker.
+	Latency time.Duration `json:"latency"`
+	// Error is the reason the worker is unhealthy.
+	Error string `json:"error,omitempty"`
+	// Restarts is the number of times the worker process was restarted after
+	// it exited.
+	Restarts int64 `json:"restarts"`
+	// Recycles is the number of times the worker process was replaced after
+	// reaching one of the recycling limits.
+	Recycles int64 `json:"recycles"`
+	// Requests is the number of requests served by the current process.
+	Requests int64 `json:"requests"`
+	// Heap is the heap size in bytes last reported by the current process.
+	Heap int64 `json:"heap"`
+}
+
+// Health is the health of every worker of the VM.
+type Health struct {
+	// Healthy is true when every worker is ready.
+	Healthy bool `json:"healthy"`
+	// Workers is the health of each worker.
+	Workers []WorkerHealth `json:"workers"`
+}
+
+// Live returns true when at least one worker is ready.
+func (h Health) Live() bool {
+	for _, worker := range h.Workers {
+		if worker.State == WorkerReady {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (vm *nodeJsVM) Ready(ctx context.Context) error {
+	for {
+		changed := vm.changedChannel()
+
+		if vm.readyWorkers() >= len(vm.workers) {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (vm *nodeJsVM) Health(ctx context.Context) Health {
+	health := Health{
+		Healthy: true,
+		Workers: make([]WorkerHealth, len(vm.workers)),
+	}
+
+	var wg sync.WaitGroup
+
+	for i, w := range vm.workers {
+		wg.Add(1)
+
+		go func(i int, w *worker) {
+			defer wg.Done()
+
+			health.Workers[i] = vm.ping(ctx, w)
+		}(i, w)
+	}
+
+	wg.Wait()
+
+	for _, worker := range health.Workers {
+		if worker.State != WorkerReady {
+			health.Healthy = false
+		}
+	}
+
+	return health
+}
+
+func (vm *nodeJsVM) ping(ctx context.Context, w *worker) WorkerHealth {
+	health := WorkerHealth{Restarts: w.Restarts(), Recycles: w.Recycles()}
+
+	p := w.Process()
+	if p == nil {
+		health.State = WorkerRestarting
+		return health
+	}
+
+	health.PID = p.PID()
+	health.Requests = atomic.LoadInt64(&p.requests)
+
+	connection := w.Connection()
+	if connection == nil {
+		health.State = WorkerStarting
+		return health
+	}
+
+	health.ID = connection.ID
+
+	start := time.Now()
+
+	result, err := connection.Send(ctx, protocol.Frame{
+		Version: protocol.Version,
+		ID:      xid.New().String(),
+		Type:    protocol.TypePing,
+	})
+
+	health.Latency = time.Since(start)
+
+	if result.Heap > 0 {
+		atomic.StoreInt64(&p.heap, result.Heap)
+	}
+
+	health.Heap = atomic.LoadInt64(&p.heap)
+
+	switch {
+	case err != nil:
+		health.State = WorkerUnhealthy
+		health.Error = err.Error()
+	case result.Type != protocol.TypeResult:
+		health.State = WorkerUnhealthy
+		health.Error = "unexpected ping result: " + result.Type
+	default:
+		health.State = WorkerReady
+	}
+
+	return health
+}
+
+func (vm *nodeJsVM) readyWorkers() int {
+	count := 0
+
+	for _, w := range vm.workers {
+		// The connection of a worker that crashed is closed before its
+		// supervisor notices the process exited.
+		if connection := w.Connection(); connection != nil && !connection.isClosed() {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (vm *nodeJsVM) changedChannel() chan struct{} {
+	vm.changedMutex.Lock()
+	defer vm.changedMutex.Unlock()
+
+	return vm.changed
+}
+
+// notifyChanged wakes up everyone waiting for the connections to change and
+// schedules queued requests on new connections.
+func (vm *nodeJsVM) notifyChanged() {
+	vm.changedMutex.Lock()
+	close(vm.changed)
+	vm.changed = make(chan struct{})
+	vm.changedMutex.Unlock()
+
+	vm.scheduler.Dispatch()
+}
@@ -0,0 +1,56 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReadyAfterWorkerCrash(t *testing.T) {
+	vm := newTestVM(t, Options{RestartBackoff: time.Minute})
+
+	health := vm.Health(context.Background())
+	if !health.Healthy || !health.Live() {
+		t.Fatalf("expected a healthy VM, got %+v", health)
+	}
+
+	connection := vm.workers[0].Connection()
+
+	if err := killProcesses(vm.workers[0].Process()); err != nil {
+		t.Fatalf("could not kill worker: %v", err)
+	}
+
+	select {
+	case <-connection.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection of the killed worker was not closed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := vm.Ready(ctx); err == nil {
+		t.Fatal("expected Ready to fail after the worker crashed")
+	}
+
+	health = vm.Health(context.Background())
+	if health.Healthy || health.Live() {
+		t.Fatalf("expected an unhealthy VM, got %+v", health)
+	}
+}
+
+func TestHealthReportsWorkers(t *testing.T) {
+	vm := newTestVM(t, Options{NodeProcesses: 2})
+
+	health := vm.Health(context.Background())
+
+	if len(health.Workers) != 2 {
+		t.Fatalf("expected 2 workers, got %d", len(health.Workers))
+	}
+
+	for _, worker := range health.Workers {
+		if worker.State != WorkerReady || worker.PID == 0 || worker.ID == "" {
+			t.Errorf("expected a ready worker, got %+v", worker)
+		}
+	}
+}
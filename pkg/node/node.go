@@ -1,20 +1,21 @@
 package node
 
 import (
-	"bufio"
+	"context"
 	_ "embed"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
-	"math"
 	"net"
-	"os/exec"
+	"net/http"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/lukeshay/govite/internal/logging"
+	"github.com/lukeshay/govite/internal/protocol"
 	"github.com/lukeshay/govite/pkg/utils/nodejs"
 	"github.com/rs/xid"
 )
@@ -24,7 +25,34 @@ var runtimeJs []byte
 
 // VM is a Javascript Virtual Machine running on Node.js
 type VM interface {
+	// Run imports the given module and returns its default export.
 	Run(javascript string) (any, error)
+	// Load imports the module on every worker, and on every worker started
+	// later before it receives requests.
+	Load(ctx context.Context, module string) error
+	// Call calls the named export of the module with the arguments encoded as
+	// JSON and returns its result. The module is imported once per worker.
+	Call(ctx context.Context, module string, export string, args ...any) (any, error)
+	// Eval evaluates the Javascript source on a worker and returns its
+	// completion value.
+	Eval(ctx context.Context, source string) (any, error)
+	// RegisterFunc makes fn callable from Javascript as
+	// `await govite.call(name, args)`.
+	RegisterFunc(name string, fn Func)
+	// Render calls the render function exported by the given server entry with
+	// the url and props. The entry is imported once per worker.
+	Render(ctx context.Context, entry string, url string, props any) (any, error)
+	// Ready blocks until every worker of the VM is initialized or the context
+	// is done.
+	Ready(ctx context.Context) error
+	// Health pings every worker of the VM and reports their state.
+	Health(ctx context.Context) Health
+	// Stats returns a snapshot of the queue and the workers of the VM.
+	Stats() Stats
+	// Shutdown stops accepting requests, waits for the pending ones and stops
+	// the workers. See nodeJsVM.Shutdown.
+	Shutdown(ctx context.Context) error
+	// Close kills the workers immediately.
 	Close() error
 }
 
@@ -36,18 +64,110 @@ type Options struct {
 	// Flags are the additional startup flags that are provided to the "node"
 	// process.
 	Flags []string
-	// sort is the port to run the websocket server on. This defaults to 6543.
+	// Port is the TCP port the workers connect to when no Transport is given.
+	// Default is an ephemeral port.
 	Port int
-	// Stdout is the output writer for the VM. Default is os.Stdout.
+	// Transport is the transport the workers connect to. Default is a TCP
+	// transport on localhost and Port.
+	Transport Transport
+	// Stdout is the output writer for the VM. Default is to log every line
+	// with Logger at the info level.
 	Stdout io.Writer
-	// Stderr is the error writer for the VM. Default is os.Stderr.
+	// Stderr is the error writer for the VM. Default is to log every line
+	// with Logger at the error level.
 	Stderr io.Writer
 	// Env is the environment variables to be set for the VM.
 	Env []string
 	// NodeProcesses is the number of node processes to run. Default is 5.
 	NodeProcesses int
-	// Logger is the logger to be used for the VM.
+	// Logger is the logger to be used for the VM. Console calls of the
+	// workers are logged with it at their level, with the pid of the worker
+	// and the ID of the request they were made in.
 	Logger *slog.Logger
+	// Debug makes the workers log what they are doing at the debug level.
+	Debug bool
+	// Runtime is the Javascript runtime used to run the VM. Default is
+	// nodejs.Node.
+	Runtime nodejs.Runtime
+	// WaitForReady makes NewNodeJS block until every worker is initialized.
+	WaitForReady bool
+	// ReadyTimeout is the maximum time NewNodeJS waits for the workers when
+	// WaitForReady is set, and a new worker is given to import the modules
+	// passed to Load. Default is 30 seconds.
+	ReadyTimeout time.Duration
+	// RestartBackoff is the delay before a node process that exited is
+	// restarted. It doubles with every consecutive restart. Default is 100
+	// milliseconds.
+	RestartBackoff time.Duration
+	// MaxRestartBackoff is the upper bound of RestartBackoff. A process that
+	// ran for longer than this resets the backoff. Default is 30 seconds.
+	MaxRestartBackoff time.Duration
+	// MaxRequestsPerWorker is the number of requests after which a node
+	// process is replaced. Default is no limit.
+	MaxRequestsPerWorker int64
+	// MaxWorkerHeap is the heap size in bytes, as reported by a node process
+	// after each request, after which the process is replaced. Default is no
+	// limit.
+	MaxWorkerHeap int64
+	// MaxWorkerAge is the time after which a node process is replaced. Default
+	// is no limit.
+	MaxWorkerAge time.Duration
+	// DrainTimeout is the maximum time a replaced node process is given to
+	// finish its in-flight requests before it is killed. Default is 30
+	// seconds.
+	DrainTimeout time.Duration
+	// MaxConcurrencyPerWorker is the number of requests a single node process
+	// handles at the same time. Default is 8.
+	MaxConcurrencyPerWorker int
+	// MaxQueueSize is the number of requests that wait for a node process when
+	// every process is busy. Requests beyond it fail with ErrOverloaded.
+	// Default is 1024.
+	MaxQueueSize int
+	// QueueTimeout is the maximum time a request waits for a node process
+	// before it fails with ErrOverloaded. Default is 10 seconds.
+	QueueTimeout time.Duration
+	// Observer is notified about every request. Default is none.
+	Observer Observer
+	// Tracer traces every request, including the spans recorded by the
+	// workers. Default is none.
+	Tracer Tracer
+	// TerminateTimeout is the time node processes are given to exit after
+	// SIGTERM before they are killed. Default is 5 seconds.
+	TerminateTimeout time.Duration
+	// RenderTimeout is the maximum time a render runs on a node process. The
+	// process of a render that misses it is killed and replaced, and its
+	// other in-flight requests are retried on another process. Default is no
+	// limit.
+	RenderTimeout time.Duration
+	// MaxOldSpaceSize is the size in megabytes of the old generation of the
+	// V8 heap of every node process. A process that runs out of memory exits
+	// and is restarted. Default is the V8 default.
+	MaxOldSpaceSize int
+	// MaxSemiSpaceSize is the size in megabytes of a semi-space of the young
+	// generation of the V8 heap of every node process. Default is the V8
+	// default.
+	MaxSemiSpaceSize int
+	// V8Flags are additional V8 flags for every node process, i.e.
+	// "--stack-size=2048". Bun runs on JavaScriptCore and ignores them.
+	V8Flags []string
+	// Handler serves the relative and same-origin fetches made while
+	// rendering in-process instead of over the network. See WithRequest.
+	// Default is none.
+	Handler http.Handler
+}
+
+// v8Flags returns the V8 flags for the limits in the options.
+func (o *Options) v8Flags() []string {
+	var flags []string
+
+	if o.MaxOldSpaceSize > 0 {
+		flags = append(flags, fmt.Sprintf("--max-old-space-size=%d", o.MaxOldSpaceSize))
+	}
+	if o.MaxSemiSpaceSize > 0 {
+		flags = append(flags, fmt.Sprintf("--max-semi-space-size=%d", o.MaxSemiSpaceSize))
+	}
+
+	return append(flags, o.V8Flags...)
 }
 
 func spreadPointerDef[Type any](def *Type, values ...Type) *Type {
@@ -58,45 +178,92 @@ func spreadPointerDef[Type any](def *Type, values ...Type) *Type {
 	return &values[0]
 }
 
-type vmMessage struct {
-	ID      string `json:"id"`
-	Type    string `json:"type"`
-	Content string `json:"content"`
+// Script returns the Javascript run by every worker of the VM on the given
+// runtime. It is useful to start workers outside of a VM, i.e. to test a
+// runtime against the protocol.
+func Script(runtime nodejs.Runtime) string {
+	return nodejs.DefaultRuntime(runtime).Shim() + "\n" + string(runtimeJs)
 }
 
-type vmResult struct {
-	ID      string `json:"id"`
-	Status  string `json:"status"`
-	Content any    `json:"content"`
+// RuntimeError is the error returned when the Javascript handling a request
+// throws. It carries the name, message and stack of the Javascript error.
+type RuntimeError = protocol.Error
+
+type vmRenderContent struct {
+	Entry  string `json:"entry"`
+	URL    string `json:"url"`
+	Props  any    `json:"props"`
+	Origin string `json:"origin"`
+	Page   *Page  `json:"page,omitempty"`
 }
 
 type vmConnection struct {
 	ID               string
+	PID              int
 	Channels         sync.Map
 	Conn             net.Conn
 	InitializedMutex *sync.Mutex
 	Initialized      bool
-	Messsages        chan vmMessage
 	log              *slog.Logger
 	ChannelCount     int64
+	initialized      chan struct{}
+	closed           chan struct{}
+	closeOnce        sync.Once
+	err              error
+	reader           *protocol.Reader
+	writer           *protocol.Writer
+	// Draining is set when the connection must not receive new requests.
+	Draining atomic.Bool
+	process  atomic.Pointer[process]
+	// scheduled is the number of requests the scheduler assigned to the
+	// connection. It is guarded by the mutex of the scheduler.
+	scheduled int
+	// onRequest answers the requests made by the worker, i.e. calls to Funcs.
+	onRequest func(c *vmConnection, frame protocol.Frame)
+}
+
+func newVMConnection(conn net.Conn, log *slog.Logger) *vmConnection {
+	id := xid.New().String()
+
+	return &vmConnection{
+		ID:               id,
+		Conn:             conn,
+		Channels:         sync.Map{},
+		log:              log.With("id", id),
+		InitializedMutex: &sync.Mutex{},
+		initialized:      make(chan struct{}),
+		closed:           make(chan struct{}),
+		reader:           protocol.NewReader(conn),
+		writer:           protocol.NewWriter(conn),
+	}
 }
 
 func (c *vmConnection) Close() error {
+	return c.CloseWithError(net.ErrClosed)
+}
+
+// CloseWithError closes the connection and fails every in-flight request
+// with the given error.
+func (c *vmConnection) CloseWithError(err error) error {
 	var result *multierror.Error
 
-	result = multierror.Append(result, c.Conn.Close())
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.closed)
+
+		result = multierror.Append(result, c.Conn.Close())
+	})
 
 	return result.ErrorOrNil()
 }
 
-func (c *vmConnection) AddChannel(id string) chan vmResult {
+func (c *vmConnection) AddChannel(id string) chan protocol.Frame {
 	c.log.Debug("Adding channel", "channelId", id)
-	channel := make(chan vmResult)
+	channel := make(chan protocol.Frame, 1)
 
 	c.Channels.Store(id, channel)
 
-	count := atomic.LoadInt64(&c.ChannelCount)
-	atomic.StoreInt64(&c.ChannelCount, count+1)
+	atomic.AddInt64(&c.ChannelCount, 1)
 
 	return channel
 }
@@ -106,81 +273,123 @@ func (c *vmConnection) RemoveChannel(id string) {
 
 	c.Channels.Delete(id)
 
-	count := atomic.LoadInt64(&c.ChannelCount)
-	atomic.StoreInt64(&c.ChannelCount, count-1)
+	atomic.AddInt64(&c.ChannelCount, -1)
 }
 
 func (c *vmConnection) GetPendingRequests() int64 {
 	return atomic.LoadInt64(&c.ChannelCount)
 }
 
-func (c *vmConnection) WaitForInitialization() {
-	c.log.Debug("Waiting for initialization")
-
-	for {
-		if c.Initialized {
-			return
+// Drain blocks until the connection has no pending requests, the connection
+// is closed or the context is done.
+func (c *vmConnection) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for c.GetPendingRequests() > 0 {
+		select {
+		case <-ticker.C:
+		case <-c.closed:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
+
+	return nil
 }
 
-func (c *vmConnection) HandleMessages() {
-	c.WaitForInitialization()
+func (c *vmConnection) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
 
-	c.log.Debug("Handling messages")
+func (c *vmConnection) Initialize(pid int) {
+	c.InitializedMutex.Lock()
+	defer c.InitializedMutex.Unlock()
 
-	for {
-		message := <-c.Messsages
+	if c.Initialized {
+		return
+	}
 
-		c.log.Debug("Handling message", "message", message)
+	c.PID = pid
+	c.Initialized = true
+	close(c.initialized)
+}
 
-		marshalled, err := json.Marshal(message)
-		if err != nil {
-			c.log.Debug("Error marshalling message", "error", err)
-			continue
+// Send sends the message to the runtime and waits for its result.
+func (c *vmConnection) Send(ctx context.Context, message protocol.Frame) (protocol.Frame, error) {
+	channel := c.AddChannel(message.ID)
+	defer c.RemoveChannel(message.ID)
+
+	if err := c.writer.WriteFrame(message); err != nil {
+		if c.isClosed() {
+			return protocol.Frame{}, c.err
 		}
 
-		c.Conn.Write(append(marshalled, '\n'))
+		return protocol.Frame{}, err
 	}
-}
 
-func (c *vmConnection) Initialize() {
-	c.InitializedMutex.Lock()
-	c.Initialized = true
-	c.InitializedMutex.Unlock()
-}
+	c.log.Debug("Sent message", "id", message.ID, "type", message.Type)
 
-func (c *vmConnection) ListenForResultAndDispatch() error {
-	c.log.Debug("Listening for results")
+	select {
+	case result := <-channel:
+		return result, nil
+	case <-c.closed:
+		return protocol.Frame{}, c.err
+	case <-ctx.Done():
+		return protocol.Frame{}, ctx.Err()
+	}
+}
 
-	buffer, err := bufio.NewReader(c.Conn).ReadBytes('\n')
+// ReadFrame reads the next frame sent by the runtime.
+func (c *vmConnection) ReadFrame() (protocol.Frame, error) {
+	frame, err := c.reader.ReadFrame()
 	if err != nil {
 		c.log.Debug("Error reading from connection", "error", err)
-
-		return err
 	}
 
-	bufferWithoutNewline := buffer[:len(buffer)-1]
+	return frame, err
+}
 
-	var result vmResult
-	if err := json.Unmarshal(bufferWithoutNewline, &result); err != nil {
-		c.log.Debug("Error unmarshalling result", "error", err)
+func (c *vmConnection) ListenForResultAndDispatch() error {
+	c.log.Debug("Listening for results")
 
-		return nil
-	}
+	result, err := c.ReadFrame()
+	if errors.Is(err, protocol.ErrInvalidFrame) {
+		if result.ID == "" {
+			c.log.Debug("Ignoring invalid frame", "error", err)
 
-	if result.ID == "INITIALIZED" {
-		c.log.Debug("Received initialization message")
+			return nil
+		}
 
-		c.Initialize()
-	} else {
-		go func() {
-			c.log.Debug("Dispatching result", "result", result)
+		result = protocol.NewErrorFrame(result.ID, &protocol.Error{
+			Code:    protocol.CodeInvalidFrame,
+			Message: err.Error(),
+		})
+	} else if err != nil {
+		return err
+	}
 
-			channel, _ := c.Channels.Load(result.ID)
+	switch result.Type {
+	case protocol.TypeLog:
+		c.LogFrame(result)
+	case protocol.TypeInvoke, protocol.TypeFetch:
+		if c.onRequest != nil {
+			go c.onRequest(c, result)
+		}
+	case protocol.TypeResult, protocol.TypeError:
+		c.log.Debug("Dispatching result", "id", result.ID, "type", result.Type)
 
-			channel.(chan vmResult) <- result
-		}()
+		if channel, ok := c.Channels.Load(result.ID); ok {
+			channel.(chan protocol.Frame) <- result
+		}
+	default:
+		c.log.Debug("Ignoring unexpected frame", "id", result.ID, "type", result.Type)
 	}
 
 	return nil
@@ -188,85 +397,134 @@ func (c *vmConnection) ListenForResultAndDispatch() error {
 
 type nodeJsVM struct {
 	options          *Options
-	cmds             []*exec.Cmd
-	socket           net.Listener
+	runtime          nodejs.Runtime
+	script           string
+	workers          []*worker
+	transport        Transport
 	connectionsMutex sync.Mutex
 	connections      sync.Map
 	log              *slog.Logger
 	requests         int64
+	processes        sync.Map
+	changedMutex     sync.Mutex
+	changed          chan struct{}
+	closed           chan struct{}
+	closeOnce        sync.Once
+	stopping         chan struct{}
+	stopOnce         sync.Once
+	scheduler        *scheduler
+	funcs            Funcs
+	handshakeTimeout time.Duration
+	// modules are the modules passed to Load, in order.
+	modulesMutex sync.Mutex
+	modules      []string
+	// running are the processes of every worker that did not exit yet.
+	running sync.Map
+	// pending are the requests that were not answered yet.
+	pending sync.Map
 }
 
 // Returns a Javascript Virtual Machine running an isolated process of
 // Node.js.
 func NewNodeJS(options ...Options) (VM, error) {
 	option := spreadPointerDef(&Options{
-		Port: 6543,
-		Dir:  ".",
-		Env:  []string{},
+		Dir: ".",
+		Env: []string{},
 	}, options...)
 
-	if option.Port == 0 {
-		option.Port = 6543
-	}
 	if option.Dir == "" {
 		option.Dir = "."
 	}
+	if option.RestartBackoff == 0 {
+		option.RestartBackoff = 100 * time.Millisecond
+	}
+	if option.MaxRestartBackoff == 0 {
+		option.MaxRestartBackoff = 30 * time.Second
+	}
+	if option.DrainTimeout == 0 {
+		option.DrainTimeout = 30 * time.Second
+	}
+	if option.MaxConcurrencyPerWorker == 0 {
+		option.MaxConcurrencyPerWorker = 8
+	}
+	if option.MaxQueueSize == 0 {
+		option.MaxQueueSize = 1024
+	}
+	if option.QueueTimeout == 0 {
+		option.QueueTimeout = 10 * time.Second
+	}
+	if option.TerminateTimeout == 0 {
+		option.TerminateTimeout = 5 * time.Second
+	}
+	if option.ReadyTimeout == 0 {
+		option.ReadyTimeout = 30 * time.Second
+	}
 
-	flags := []string{"--experimental-detect-module", "--no-warnings", "--input-type=module", "-e", string(runtimeJs)}
+	runtime := nodejs.DefaultRuntime(option.Runtime)
 
-	if option != nil {
-		flags = append(flags, option.Flags...)
-	}
+	transport := option.Transport
+	if transport == nil {
+		tcp, err := NewTCPTransport(fmt.Sprintf("localhost:%d", option.Port))
+		if err != nil {
+			return nil, err
+		}
 
-	socket, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", option.Port))
-	if err != nil {
-		return nil, err
+		transport = tcp
 	}
 
 	log := logging.NewDefaultLogger(option.Logger)
 
-	cmds := []*exec.Cmd{}
-
 	nodeProcesses := option.NodeProcesses
 	if nodeProcesses == 0 {
 		nodeProcesses = 5
 	}
 
-	log.Debug("Starting node processes", "processes", nodeProcesses, "dir", option.Dir)
+	vm := &nodeJsVM{
+		options:     option,
+		runtime:     runtime,
+		script:      Script(runtime),
+		transport:   transport,
+		connections: sync.Map{},
+		log:         log,
+		changed:     make(chan struct{}),
+		closed:      make(chan struct{}),
+		stopping:    make(chan struct{}),
 
-	for i := 0; i < nodeProcesses; i++ {
-		cmd := nodejs.NewNodeJSCommand(nodejs.NodeJSCommandOptions{
-			Script: string(runtimeJs),
-			Dir:    option.Dir,
-			Stdout: option.Stdout,
-			Stderr: option.Stderr,
-			Env: map[string]string{
-				"PORT": fmt.Sprintf("%d", option.Port),
-			},
-			Flags: flags,
-		})
+		handshakeTimeout: handshakeTimeout,
+	}
+
+	vm.scheduler = newScheduler(vm)
 
-		cmd.Env = append(cmd.Env, option.Env...)
+	log.Debug("Starting node processes", "processes", nodeProcesses, "dir", option.Dir, "runtime", runtime.Name(), "transport", transport.Name())
 
-		if err := cmd.Start(); err != nil {
+	for i := 0; i < nodeProcesses; i++ {
+		w := &worker{
+			index: i,
+			log:   log.With("worker", i),
+		}
+
+		if err := vm.startWorker(w); err != nil {
 			log.Info("Error starting node process", "error", err)
-			socket.Close()
+			vm.Close()
 			return nil, err
 		}
 
-		cmds = append(cmds, cmd)
-	}
-
-	vm := &nodeJsVM{
-		options:     option,
-		cmds:        cmds,
-		socket:      socket,
-		connections: sync.Map{},
-		log:         log,
+		vm.workers = append(vm.workers, w)
 	}
 
 	go vm.acceptConnections()
 
+	if option.WaitForReady {
+		ctx, cancel := context.WithTimeout(context.Background(), option.ReadyTimeout)
+		defer cancel()
+
+		if err := vm.Ready(ctx); err != nil {
+			log.Info("Node processes did not become ready", "error", err)
+			vm.Close()
+			return nil, err
+		}
+	}
+
 	return vm, nil
 }
 
@@ -283,58 +541,182 @@ func (vm *nodeJsVM) GetPendingRequests() int64 {
 }
 
 func (vm *nodeJsVM) addPendingRequest() {
-	requests := atomic.LoadInt64(&vm.requests)
-	atomic.AddInt64(&vm.requests, requests+1)
+	atomic.AddInt64(&vm.requests, 1)
 }
 
 func (vm *nodeJsVM) removePendingRequest() {
-	requests := atomic.LoadInt64(&vm.requests)
-	atomic.AddInt64(&vm.requests, requests-1)
+	atomic.AddInt64(&vm.requests, -1)
 }
 
 func (vm *nodeJsVM) Run(javascript string) (any, error) {
+	return vm.send(context.Background(), protocol.TypeImport, javascript)
+}
+
+func (vm *nodeJsVM) Render(ctx context.Context, entry string, url string, props any) (any, error) {
+	content := vmRenderContent{
+		Entry:  entry,
+		URL:    url,
+		Props:  props,
+		Origin: Origin(ctx),
+	}
+
+	if page, ok := PageFromContext(ctx); ok {
+		content.Page = &page
+	}
+
+	return vm.send(ctx, protocol.TypeRender, content)
+}
+
+func (vm *nodeJsVM) send(ctx context.Context, messageType string, content any) (any, error) {
+	result, err := vm.request(ctx, messageType, content)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	if err := result.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// request schedules a request on a worker and returns its result frame. Error
+// frames are returned as errors.
+func (vm *nodeJsVM) request(ctx context.Context, messageType string, content any) (_ protocol.Frame, err error) {
 	vm.addPendingRequest()
 	defer vm.removePendingRequest()
 
-	message := vmMessage{
-		ID:      xid.New().String(),
-		Type:    "import",
-		Content: javascript,
+	message, err := protocol.NewFrame(xid.New().String(), messageType, content)
+	if err != nil {
+		return protocol.Frame{}, err
 	}
 
-	vm.log.Debug("Running javascript", "message", message)
+	stats := RequestStats{Type: messageType, Worker: -1}
 
-	connection := vm.getOpenConnection()
+	ctx, end := vm.startSpan(ctx, "govite.vm."+messageType, nil)
 
-	vm.log.Debug("Got open connection", "id", connection.ID)
+	// Funcs called by the request must not outlive it.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	channel := connection.AddChannel(message.ID)
+	pending := &pendingRequest{ctx: ctx, id: message.ID, kind: messageType, startedAt: time.Now()}
+	pending.worker.Store(-1)
 
-	vm.log.Debug("Added channel", "id", message.ID)
+	vm.pending.Store(message.ID, pending)
+	defer vm.pending.Delete(message.ID)
 
-	go func() { connection.Messsages <- message }()
+	defer func() {
+		stats.Err = err
+		vm.observe(stats)
+		end(err)
+	}()
 
-	vm.log.Debug("Sent message", "message", message)
+	if vm.options.Tracer != nil {
+		message.Traceparent = vm.options.Tracer.Traceparent(ctx)
+	}
 
-	result := <-channel
+	vm.log.Debug("Sending message", "id", message.ID, "type", message.Type)
 
-	connection.RemoveChannel(message.ID)
+	var result protocol.Frame
 
-	vm.log.Debug("Received result", "result", result)
+	for {
+		start := time.Now()
 
-	if result.Status == "error" {
-		return "", fmt.Errorf(result.Content.(string))
+		connection, err := vm.scheduler.Acquire(ctx)
+
+		stats.QueueWait += time.Since(start)
+
+		if err != nil {
+			return protocol.Frame{}, err
+		}
+
+		if p := connection.process.Load(); p != nil {
+			stats.Worker = p.worker.index
+			pending.worker.Store(int64(p.worker.index))
+		}
+
+		vm.log.Debug("Scheduled message", "id", message.ID, "connection", connection.ID)
+
+		start = time.Now()
+
+		var retry bool
+		result, retry, err = vm.sendTo(ctx, connection, message)
+
+		stats.Duration += time.Since(start)
+		stats.ResultSize = len(result.Content)
+
+		vm.scheduler.Release(connection)
+
+		if retry {
+			vm.log.Debug("Retrying message of killed node process", "id", message.ID, "connection", connection.ID)
+
+			continue
+		}
+
+		if err != nil {
+			return protocol.Frame{}, err
+		}
+
+		vm.afterRequest(connection, result)
+
+		break
 	}
 
-	return result.Content, nil
+	vm.log.Debug("Received result", "id", result.ID, "type", result.Type)
+
+	if vm.options.Tracer != nil && len(result.Spans) > 0 {
+		vm.options.Tracer.Export(ctx, result.Spans)
+	}
+
+	if result.Type == protocol.TypeError {
+		return protocol.Frame{}, result.Error
+	}
+
+	return result, nil
+}
+
+// sendTo sends the message on the connection. A render that misses the render
+// timeout kills the process of the connection. Retry is set for the other
+// requests that were in-flight on the killed process, as they did not fail on
+// their own.
+func (vm *nodeJsVM) sendTo(ctx context.Context, connection *vmConnection, message protocol.Frame) (_ protocol.Frame, retry bool, _ error) {
+	sendCtx := ctx
+
+	if message.Type == protocol.TypeRender && vm.options.RenderTimeout > 0 {
+		var cancel context.CancelFunc
+
+		sendCtx, cancel = context.WithTimeoutCause(ctx, vm.options.RenderTimeout, ErrRenderTimeout)
+		defer cancel()
+	}
+
+	result, err := connection.Send(sendCtx, message)
+	if err == nil {
+		return result, false, nil
+	}
+
+	if ctx.Err() == nil && context.Cause(sendCtx) == ErrRenderTimeout {
+		vm.killHungProcess(connection, message.ID)
+
+		return result, false, &RenderTimeoutError{PID: connection.PID, Timeout: vm.options.RenderTimeout}
+	}
+
+	if p := connection.process.Load(); p != nil && errors.Is(err, ErrWorkerExited) && ctx.Err() == nil {
+		if killedFor := p.killedFor.Load(); killedFor != nil && *killedFor != message.ID {
+			return result, true, err
+		}
+	}
+
+	return result, false, err
 }
 
 func (vm *nodeJsVM) Close() error {
 	var result *multierror.Error
 
-	for _, cmd := range vm.cmds {
-		result = multierror.Append(result, cmd.Process.Kill())
-	}
+	vm.stopOnce.Do(func() { close(vm.stopping) })
+	vm.closeOnce.Do(func() { close(vm.closed) })
+
+	result = multierror.Append(result, killProcesses(vm.runningProcesses()...))
 
 	vm.connectionsMutex.Lock()
 	defer vm.connectionsMutex.Unlock()
@@ -347,81 +729,109 @@ func (vm *nodeJsVM) Close() error {
 		return true
 	})
 
-	result = multierror.Append(result, vm.socket.Close())
+	result = multierror.Append(result, vm.transport.Close())
 
 	return result.ErrorOrNil()
 }
 
 func (vm *nodeJsVM) acceptConnections() {
 	for {
-		connection, err := vm.socket.Accept()
+		connection, err := vm.transport.Accept()
 		if err != nil {
 			return
 		}
 
 		vm.log.Debug("Accepted connection", "address", connection.RemoteAddr().String())
 
-		id := xid.New().String()
+		go vm.handleConnection(newVMConnection(connection, vm.log), nil)
+	}
+}
+
+// handleConnection authenticates the connection and dispatches its results
+// until it is closed. If expected is not nil, the connection must belong to
+// that process.
+func (vm *nodeJsVM) handleConnection(connection *vmConnection, expected *process) {
+	connection.onRequest = vm.serveWorker
+
+	p, err := vm.authenticate(connection, expected)
+	if err != nil {
+		vm.log.Warn("Rejected connection", "address", connection.Conn.RemoteAddr().String(), "error", err)
+
+		connection.CloseWithError(err)
 
-		vmConn := &vmConnection{
-			ID:               id,
-			Conn:             connection,
-			Messsages:        make(chan vmMessage),
-			Channels:         sync.Map{},
-			log:              vm.log.With("id", id),
-			InitializedMutex: &sync.Mutex{},
+		// A process whose own connection was rejected never serves requests,
+		// so it is replaced by its supervisor.
+		if expected != nil {
+			killProcesses(expected)
 		}
 
-		go vm.handleConnection(vmConn)
+		return
 	}
-}
 
-func (vm *nodeJsVM) handleConnection(connection *vmConnection) {
-	vm.connections.Store(connection.ID, connection)
-
-	go connection.HandleMessages()
+	go vm.prepareConnection(connection, p)
 
 	for {
 		err := connection.ListenForResultAndDispatch()
 		if err != nil {
 			vm.log.Debug("Error listening for result and dispatching", "error", err)
 
-			connection.Close()
+			connection.CloseWithError(&WorkerExitError{PID: connection.PID, Err: err})
 
-			vm.connections.Delete(connection.ID)
+			vm.removeConnection(connection)
 
 			return
 		}
 	}
 }
 
-func (vm *nodeJsVM) getOpenConnection() *vmConnection {
-	vm.log.Debug("Getting available connection")
+// attachConnection ties an authenticated connection to its process. When the
+// process is the replacement of a recycled process, it takes over the worker
+// and the recycled process is retired.
+func (vm *nodeJsVM) attachConnection(connection *vmConnection, p *process) {
+	var retired *process
 
-	found := ""
+	w := p.worker
 
-	for {
-		vm.connections.Range(func(key any, value any) bool {
-			vmConnection := value.(*vmConnection)
+	w.mutex.Lock()
+	p.connection = connection
 
-			if vmConnection.Initialized && float64(vmConnection.GetPendingRequests()) <= math.Ceil(float64(vm.GetPendingRequests())/float64(len(vm.cmds))) {
+	if p == w.replacement {
+		// The recycled process may have exited in the meantime.
+		if retired = w.process; retired != nil {
+			retired.retired = true
+			if retired.ageTimer != nil {
+				retired.ageTimer.Stop()
+			}
+			if retired.connection != nil {
+				retired.connection.Draining.Store(true)
+			}
+		}
 
-				vm.log.Debug("Found open connection", "id", vmConnection.ID)
+		w.process = p
+		w.replacement = nil
 
-				found = key.(string)
+		atomic.AddInt64(&w.recycles, 1)
+	}
+	w.mutex.Unlock()
 
-				return false
-			}
+	if retired != nil {
+		go vm.retire(retired)
+	}
 
-			return true
-		})
+	vm.notifyChanged()
+}
 
-		if found != "" {
-			break
-		}
+func (vm *nodeJsVM) isClosed() bool {
+	select {
+	case <-vm.closed:
+		return true
+	default:
+		return false
 	}
+}
 
-	connection, _ := vm.connections.Load(found)
-
-	return connection.(*vmConnection)
+func (vm *nodeJsVM) removeConnection(connection *vmConnection) {
+	if _, loaded := vm.connections.LoadAndDelete(connection.ID); loaded {
+		vm.notifyChanged()
+	}
 }
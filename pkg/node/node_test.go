@@ -0,0 +1,122 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lukeshay/govite/pkg/utils/nodejs"
+)
+
+// newTestVM starts a VM with a single worker running the fixtures in testdata
+// and closes it when the test finishes. The test is skipped with -short or
+// when the runtime is not installed.
+func newTestVM(t *testing.T, options ...Options) *nodeJsVM {
+	t.Helper()
+
+	option := Options{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+
+	if testing.Short() {
+		t.Skip("skipping node VM in short mode")
+	}
+
+	runtime := nodejs.DefaultRuntime(option.Runtime).Name()
+	if _, err := exec.LookPath(runtime); err != nil {
+		t.Skipf("%s is not installed: %v", runtime, err)
+	}
+
+	option.Dir = "testdata"
+	option.WaitForReady = true
+
+	if option.NodeProcesses == 0 {
+		option.NodeProcesses = 1
+	}
+	if option.Logger == nil {
+		option.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	vm, err := NewNodeJS(option)
+	if err != nil {
+		t.Fatalf("could not start VM: %v", err)
+	}
+
+	t.Cleanup(func() { vm.Close() })
+
+	return vm.(*nodeJsVM)
+}
+
+// testEntry returns the absolute path of the server entry in testdata.
+func testEntry(t *testing.T) string {
+	t.Helper()
+
+	entry, err := filepath.Abs(filepath.Join("testdata", "entry.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return entry
+}
+
+func TestRuntimes(t *testing.T) {
+	for _, runtime := range []nodejs.Runtime{nodejs.Node, nodejs.Bun, nodejs.Deno} {
+		t.Run(runtime.Name(), func(t *testing.T) {
+			vm := newTestVM(t, Options{Runtime: runtime})
+
+			result, err := vm.Render(context.Background(), testEntry(t), "/users/7", map[string]any{"id": "7"})
+			if err != nil {
+				t.Fatalf("could not render: %v", err)
+			}
+			if html := result.(map[string]any)["html"]; html != "<p>/users/7</p>" {
+				t.Errorf("unexpected html %v", html)
+			}
+		})
+	}
+}
+
+func TestRenderSendsProps(t *testing.T) {
+	vm := newTestVM(t)
+
+	props := map[string]any{
+		"name":  "govite",
+		"tags":  []any{"a", "b"},
+		"large": strings.Repeat("x", 1<<20),
+	}
+
+	result, err := vm.Render(context.Background(), testEntry(t), "/users/7", props)
+	if err != nil {
+		t.Fatalf("could not render: %v", err)
+	}
+
+	rendered := result.(map[string]any)
+
+	if rendered["html"] != "<p>/users/7</p>" {
+		t.Errorf("unexpected html %v", rendered["html"])
+	}
+	if !reflect.DeepEqual(rendered["props"], props) {
+		t.Errorf("props were not sent unchanged")
+	}
+}
+
+func TestRenderRuntimeError(t *testing.T) {
+	vm := newTestVM(t)
+
+	_, err := vm.Render(context.Background(), testEntry(t), "/", map[string]any{"throw": "boom"})
+
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a RuntimeError, got %v", err)
+	}
+
+	if runtimeErr.Message != "boom" || runtimeErr.Name != "Error" || runtimeErr.Stack == "" {
+		t.Errorf("unexpected error %+v", runtimeErr)
+	}
+}
@@ -0,0 +1,92 @@
+package node
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Observer is notified about every request handled by the VM. It lets
+// packages like pkg/metrics collect metrics without the VM depending on a
+// metrics library. It is called synchronously and must not block.
+type Observer interface {
+	ObserveRequest(stats RequestStats)
+}
+
+// RequestStats describes a single request handled by the VM.
+type RequestStats struct {
+	// Type is the type of the request, i.e. "render".
+	Type string
+	// Worker is the index of the worker the request was scheduled on. It is -1
+	// if the request was never scheduled.
+	Worker int
+	// QueueWait is the time the request waited for a worker.
+	QueueWait time.Duration
+	// Duration is the time the worker took to answer the request.
+	Duration time.Duration
+	// ResultSize is the size in bytes of the encoded result.
+	ResultSize int
+	// Err is the error of the request, if any.
+	Err error
+}
+
+// Stats is a snapshot of the state of the VM.
+type Stats struct {
+	// Queued is the number of requests waiting for a worker.
+	Queued int
+	// Workers is the state of each worker.
+	Workers []WorkerStats
+}
+
+// WorkerStats is a snapshot of the state of a single worker.
+type WorkerStats struct {
+	// Worker is the index of the worker.
+	Worker int
+	// PID is the process ID of the current process of the worker. It is 0
+	// while the worker is restarting.
+	PID int
+	// InFlight is the number of requests sent to the worker that were not
+	// answered yet.
+	InFlight int64
+	// Restarts is the number of times the worker process was restarted after
+	// it exited.
+	Restarts int64
+	// Recycles is the number of times the worker process was replaced after
+	// reaching one of the recycling limits.
+	Recycles int64
+	// Requests is the number of requests served by the current process.
+	Requests int64
+}
+
+func (vm *nodeJsVM) Stats() Stats {
+	stats := Stats{
+		Queued:  vm.scheduler.Queued(),
+		Workers: make([]WorkerStats, len(vm.workers)),
+	}
+
+	for i, w := range vm.workers {
+		worker := WorkerStats{
+			Worker:   w.index,
+			Restarts: w.Restarts(),
+			Recycles: w.Recycles(),
+		}
+
+		if p := w.Process(); p != nil {
+			worker.PID = p.PID()
+			worker.Requests = atomic.LoadInt64(&p.requests)
+		}
+
+		if connection := w.Connection(); connection != nil {
+			worker.InFlight = connection.GetPendingRequests()
+		}
+
+		stats.Workers[i] = worker
+	}
+
+	return stats
+}
+
+func (vm *nodeJsVM) observe(stats RequestStats) {
+	if vm.options.Observer != nil {
+		vm.options.Observer.ObserveRequest(stats)
+	}
+}
@@ -0,0 +1,52 @@
+package node
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+type recordingObserver struct {
+	mutex sync.Mutex
+	stats []RequestStats
+}
+
+func (o *recordingObserver) ObserveRequest(stats RequestStats) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.stats = append(o.stats, stats)
+}
+
+func TestObserverAttributesRequests(t *testing.T) {
+	observer := &recordingObserver{}
+
+	vm := newTestVM(t, Options{Observer: observer, NodeProcesses: 2})
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			vm.Render(context.Background(), testEntry(t), "/", nil)
+		}()
+	}
+
+	wg.Wait()
+
+	observer.mutex.Lock()
+	defer observer.mutex.Unlock()
+
+	if len(observer.stats) != 20 {
+		t.Fatalf("expected 20 observed requests, got %d", len(observer.stats))
+	}
+
+	for _, stats := range observer.stats {
+		if stats.Err != nil || stats.Worker < 0 || stats.Type != "render" || stats.ResultSize == 0 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	}
+}
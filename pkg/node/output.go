@@ -0,0 +1,109 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/lukeshay/govite/internal/protocol"
+)
+
+// vmLog is the content of the log frames workers send for console calls.
+type vmLog struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+func logLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// LogFrame re-emits a log frame sent by the worker of the connection.
+func (c *vmConnection) LogFrame(frame protocol.Frame) {
+	var record vmLog
+	if err := frame.Decode(&record); err != nil {
+		c.log.Debug("Invalid log frame", "error", err)
+
+		return
+	}
+
+	log := c.log
+	if p := c.process.Load(); p != nil {
+		log = p.worker.log
+	}
+
+	args := []any{"pid", c.PID}
+	if frame.ID != "" {
+		args = append(args, "request", frame.ID)
+	}
+
+	log.Log(context.Background(), logLevel(record.Level), record.Message, args...)
+}
+
+// logWriter logs every line written to it. It captures the output of a
+// worker process that is not sent over the protocol, i.e. from native modules
+// or the runtime itself.
+type logWriter struct {
+	mutex  sync.Mutex
+	log    *slog.Logger
+	level  slog.Level
+	cmd    *exec.Cmd
+	buffer []byte
+}
+
+// maxLogLine is the length after which a line without a newline is logged.
+const maxLogLine = 64 << 10
+
+func newLogWriter(log *slog.Logger, level slog.Level, stream string, cmd *exec.Cmd) *logWriter {
+	return &logWriter{
+		log:   log.With("stream", stream),
+		level: level,
+		cmd:   cmd,
+	}
+}
+
+func (w *logWriter) Write(data []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.buffer = append(w.buffer, data...)
+
+	for {
+		index := bytes.IndexByte(w.buffer, '\n')
+		if index == -1 {
+			break
+		}
+
+		w.emit(w.buffer[:index])
+		w.buffer = w.buffer[index+1:]
+	}
+
+	if len(w.buffer) > maxLogLine {
+		w.emit(w.buffer)
+		w.buffer = nil
+	}
+
+	return len(data), nil
+}
+
+func (w *logWriter) emit(line []byte) {
+	message := strings.TrimRight(string(line), "\r")
+	if message == "" {
+		return
+	}
+
+	// The output is only copied once the process started, so it is set.
+	w.log.Log(context.Background(), w.level, message, "pid", w.cmd.Process.Pid)
+}
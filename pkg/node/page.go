@@ -0,0 +1,27 @@
+package node
+
+import "context"
+
+// Page is the page of the application a render is for, given to the render
+// function of the server entry as its third argument.
+type Page struct {
+	// Name is the name of the page, i.e. "users/[id]" for the file
+	// src/pages/users/[id].tsx.
+	Name string `json:"name"`
+	// Params are the values of the dynamic segments of the page, i.e. "id".
+	Params map[string]string `json:"params"`
+}
+
+type pageKey struct{}
+
+// WithPage returns a context for rendering the page.
+func WithPage(ctx context.Context, page Page) context.Context {
+	return context.WithValue(ctx, pageKey{}, page)
+}
+
+// PageFromContext returns the page passed to WithPage, if any.
+func PageFromContext(ctx context.Context) (Page, bool) {
+	page, ok := ctx.Value(pageKey{}).(Page)
+
+	return page, ok
+}
@@ -0,0 +1,202 @@
+package node
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/lukeshay/govite/internal/protocol"
+	"github.com/rs/xid"
+)
+
+type vmCallContent struct {
+	Module string `json:"module"`
+	Export string `json:"export"`
+	Args   []any  `json:"args"`
+}
+
+// resolveModule makes relative module paths absolute against the directory of
+// the VM. Bare specifiers and URLs are resolved by the workers.
+func (vm *nodeJsVM) resolveModule(module string) string {
+	if strings.HasPrefix(module, "./") || strings.HasPrefix(module, "../") {
+		if abs, err := filepath.Abs(filepath.Join(vm.options.Dir, module)); err == nil {
+			return abs
+		}
+	}
+
+	return module
+}
+
+// Load imports the module on every worker. The module is also imported by
+// every worker started later, i.e. after a restart or recycle, before it
+// receives requests, unless it failed to import.
+func (vm *nodeJsVM) Load(ctx context.Context, module string) error {
+	module = vm.resolveModule(module)
+
+	vm.modulesMutex.Lock()
+	if !slices.Contains(vm.modules, module) {
+		vm.modules = append(vm.modules, module)
+	}
+	vm.modulesMutex.Unlock()
+
+	var (
+		mutex  sync.Mutex
+		result *multierror.Error
+		wg     sync.WaitGroup
+	)
+
+	for _, w := range vm.workers {
+		connection := w.Connection()
+		if connection == nil {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := vm.load(ctx, connection, module); err != nil {
+				mutex.Lock()
+				result = multierror.Append(result, err)
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if result != nil {
+		vm.modulesMutex.Lock()
+		vm.modules = slices.DeleteFunc(vm.modules, func(m string) bool { return m == module })
+		vm.modulesMutex.Unlock()
+	}
+
+	return result.ErrorOrNil()
+}
+
+// load imports the module on the worker of the connection, bypassing the
+// scheduler.
+func (vm *nodeJsVM) load(ctx context.Context, connection *vmConnection, module string) error {
+	message, err := protocol.NewFrame(xid.New().String(), protocol.TypeLoad, module)
+	if err != nil {
+		return err
+	}
+
+	result, err := connection.Send(ctx, message)
+	if err != nil {
+		return err
+	}
+
+	if result.Type == protocol.TypeError {
+		return result.Error
+	}
+
+	return nil
+}
+
+// prepareConnection imports the loaded modules on the worker of an
+// authenticated connection and makes it available to the scheduler. A module
+// that fails to import is logged and imported again by the first call to it.
+func (vm *nodeJsVM) prepareConnection(connection *vmConnection, p *process) {
+	vm.modulesMutex.Lock()
+	modules := slices.Clone(vm.modules)
+	vm.modulesMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), vm.options.ReadyTimeout)
+	defer cancel()
+
+	vm.loadModules(ctx, connection, p, modules)
+
+	// Requests scheduled on the connection are attributed to the worker of
+	// the process as soon as it is published.
+	connection.process.Store(p)
+
+	vm.connections.Store(connection.ID, connection)
+
+	// The connection may have closed while the modules were imported, after it
+	// would have been removed.
+	if connection.isClosed() {
+		vm.removeConnection(connection)
+
+		return
+	}
+
+	vm.attachConnection(connection, p)
+
+	// Load skips workers that are not attached yet, so the modules it added
+	// since they were cloned are imported now.
+	vm.modulesMutex.Lock()
+	added := slices.DeleteFunc(slices.Clone(vm.modules), func(m string) bool { return slices.Contains(modules, m) })
+	vm.modulesMutex.Unlock()
+
+	vm.loadModules(ctx, connection, p, added)
+}
+
+// loadModules imports the modules on the worker of the connection and logs the
+// ones that fail to import.
+func (vm *nodeJsVM) loadModules(ctx context.Context, connection *vmConnection, p *process, modules []string) {
+	for _, module := range modules {
+		if err := vm.load(ctx, connection, module); err != nil {
+			p.worker.log.Info("Error loading module", "pid", connection.PID, "module", module, "error", err)
+		}
+	}
+}
+
+// Call calls the named export of the module with the arguments and returns its
+// result. The module is imported once per worker.
+func (vm *nodeJsVM) Call(ctx context.Context, module string, export string, args ...any) (any, error) {
+	return vm.send(ctx, protocol.TypeCall, vm.callContent(module, export, args))
+}
+
+func (vm *nodeJsVM) callContent(module string, export string, args []any) vmCallContent {
+	if args == nil {
+		args = []any{}
+	}
+
+	return vmCallContent{
+		Module: vm.resolveModule(module),
+		Export: export,
+		Args:   args,
+	}
+}
+
+// Eval evaluates the Javascript source as a script on a worker and returns its
+// completion value. Promises are awaited.
+func (vm *nodeJsVM) Eval(ctx context.Context, source string) (any, error) {
+	return vm.send(ctx, protocol.TypeEval, source)
+}
+
+// CallInto is like VM.Call, but decodes the result of the export into a value
+// of type T.
+func CallInto[T any](ctx context.Context, vm VM, module string, export string, args ...any) (T, error) {
+	var value T
+
+	if nodeVM, ok := vm.(*nodeJsVM); ok {
+		result, err := nodeVM.request(ctx, protocol.TypeCall, nodeVM.callContent(module, export, args))
+		if err != nil {
+			return value, err
+		}
+
+		err = result.Decode(&value)
+
+		return value, err
+	}
+
+	result, err := vm.Call(ctx, module, export, args...)
+	if err != nil {
+		return value, err
+	}
+
+	content, err := protocol.NewFrame("", "", result)
+	if err != nil {
+		return value, err
+	}
+
+	err = content.Decode(&value)
+
+	return value, err
+}
@@ -0,0 +1,163 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCall(t *testing.T) {
+	vm := newTestVM(t)
+
+	result, err := vm.Call(context.Background(), "./entry.js", "add", 2, 3)
+	if err != nil {
+		t.Fatalf("could not call: %v", err)
+	}
+	if result != float64(5) {
+		t.Errorf("expected 5, got %v", result)
+	}
+
+	sum, err := CallInto[int](context.Background(), vm, "./entry.js", "add", 2, 3)
+	if err != nil {
+		t.Fatalf("could not call: %v", err)
+	}
+	if sum != 5 {
+		t.Errorf("expected 5, got %d", sum)
+	}
+
+	var runtimeErr *RuntimeError
+	if _, err := vm.Call(context.Background(), "./entry.js", "missing"); !errors.As(err, &runtimeErr) {
+		t.Errorf("expected a RuntimeError for a missing export, got %v", err)
+	}
+}
+
+func TestEval(t *testing.T) {
+	vm := newTestVM(t)
+
+	tests := []struct {
+		source string
+		want   any
+	}{
+		{source: "1 + 2", want: float64(3)},
+		{source: "Promise.resolve('govite')", want: "govite"},
+		{source: "({ a: [true] })", want: map[string]any{"a": []any{true}}},
+	}
+
+	for _, tt := range tests {
+		got, err := vm.Eval(context.Background(), tt.source)
+		if err != nil {
+			t.Errorf("could not evaluate %s: %v", tt.source, err)
+
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.source, got, tt.want)
+		}
+	}
+
+	var runtimeErr *RuntimeError
+	if _, err := vm.Eval(context.Background(), "throw new Error('boom')"); !errors.As(err, &runtimeErr) || runtimeErr.Message != "boom" {
+		t.Errorf("expected a RuntimeError, got %v", err)
+	}
+}
+
+func TestLoadWhileReplacementIsPrepared(t *testing.T) {
+	imports := filepath.Join(t.TempDir(), "imports")
+
+	vm := newTestVM(t, Options{Env: []string{"GOVITE_TEST_IMPORTS=" + imports}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := vm.Load(ctx, "./slow_module.js"); err != nil {
+		t.Fatalf("could not load: %v", err)
+	}
+
+	w := vm.workers[0]
+
+	vm.recycle(w.Process(), "test")
+
+	// The replacement imports the slow module before it is attached.
+	waitFor(t, 5*time.Second, func() bool {
+		content, _ := os.ReadFile(imports)
+
+		return strings.Count(string(content), "\n") == 2
+	})
+
+	if err := vm.Load(ctx, "./module.js"); err != nil {
+		t.Fatalf("could not load: %v", err)
+	}
+
+	waitFor(t, 5*time.Second, func() bool { return w.Recycles() == 1 && len(vm.runningProcesses()) == 1 })
+
+	result, err := vm.Eval(ctx, "globalThis.loaded")
+	if err != nil {
+		t.Fatalf("could not evaluate: %v", err)
+	}
+	if result != float64(1) {
+		t.Errorf("expected the module to be imported by the replacement, got %v", result)
+	}
+}
+
+func TestLoadAfterRestart(t *testing.T) {
+	vm := newTestVM(t, Options{RestartBackoff: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := vm.Load(ctx, "./module.js"); err != nil {
+		t.Fatalf("could not load: %v", err)
+	}
+
+	loaded := func() any {
+		t.Helper()
+
+		result, err := vm.Eval(ctx, "globalThis.loaded")
+		if err != nil {
+			t.Fatalf("could not evaluate: %v", err)
+		}
+
+		return result
+	}
+
+	if got := loaded(); got != float64(1) {
+		t.Fatalf("expected the module to be imported once, got %v", got)
+	}
+
+	w := vm.workers[0]
+
+	if err := killProcesses(w.Process()); err != nil {
+		t.Fatalf("could not kill worker: %v", err)
+	}
+
+	waitFor(t, 5*time.Second, func() bool { return w.Restarts() == 1 })
+
+	if err := vm.Ready(ctx); err != nil {
+		t.Fatalf("restarted worker did not become ready: %v", err)
+	}
+
+	if got := loaded(); got != float64(1) {
+		t.Errorf("expected the module to be imported by the restarted worker, got %v", got)
+	}
+}
+
+func TestLoadFailure(t *testing.T) {
+	vm := newTestVM(t)
+
+	if err := vm.Load(context.Background(), "./missing.js"); err == nil {
+		t.Fatal("expected an error for a missing module")
+	}
+
+	vm.modulesMutex.Lock()
+	defer vm.modulesMutex.Unlock()
+
+	if len(vm.modules) != 0 {
+		t.Errorf("expected the module not to be kept, got %v", vm.modules)
+	}
+}
@@ -1,17 +1,170 @@
-interface BaseMessage<Type extends string> {
+/** A single line of the VM protocol. See docs/02-vm-protocol.md. */
+interface Frame<Type extends string = string, Content = any> {
+	v: number
 	id: string
-	port: number
 	type: Type
-	content: string
+	content?: Content
+	error?: FrameError
+	/** The heap size in bytes of the runtime after the frame was handled. */
+	heap?: number
+	/** The W3C traceparent of the span the request is part of. */
+	traceparent?: string
+	/** The spans recorded while handling the request. */
+	spans?: Span[]
 }
 
-interface ImportMessage extends BaseMessage<"import"> {}
-interface PingMessage extends BaseMessage<"ping"> {}
+type LogLevel = "debug" | "info" | "warn" | "error"
 
-type Message = ImportMessage | PingMessage
+/** The content of the log frames sent for console calls. */
+interface Log {
+	level: LogLevel
+	message: string
+}
+
+interface Span {
+	traceId: string
+	spanId: string
+	parentSpanId: string
+	name: string
+	/** Milliseconds since the Unix epoch. */
+	start: number
+	/** Milliseconds since the Unix epoch. */
+	end: number
+	attributes: Record<string, any>
+	error?: string
+}
+
+interface Trace {
+	traceId: string
+	/** The span of the traceparent of the request. */
+	parentSpanId: string
+	spans: Span[]
+}
 
-interface Result {
+/** The context of a request, available through AsyncLocalStorage. */
+interface RequestContext {
+	/** The ID of the frame of the request. */
 	id: string
-	status: "success" | "error"
-	content: string
+	trace?: Trace
+	/** The span new spans are children of. */
+	parentSpanId?: string
+	/** The origin relative fetches are resolved against. */
+	origin?: string
+}
+
+interface FrameError {
+	code:
+		| "invalid_frame"
+		| "unsupported_version"
+		| "unknown_type"
+		| "unauthenticated"
+		| "exception"
+		| "unknown_func"
+	name?: string
+	message: string
+	stack?: string
+}
+
+interface RenderContent {
+	/** The absolute path to the server entry exporting `render`. */
+	entry: string
+	url: string
+	props: any
+	/** The origin of the request being rendered. */
+	origin?: string
+	/** The page being rendered, passed to `render` as its third argument. */
+	page?: Page
+}
+
+interface Page {
+	/** The name of the page, i.e. "users/[id]" for src/pages/users/[id].tsx. */
+	name: string
+	/** The values of the dynamic segments of the page. */
+	params: Record<string, string>
+}
+
+interface FetchContent {
+	/** The ID of the request the fetch was made in, or empty. */
+	request: string
+	method: string
+	/** The absolute URL of the fetch. */
+	url: string
+	headers: [string, string][]
+	/** The body encoded as base64. */
+	body?: string
+}
+
+interface FetchResponse {
+	status: number
+	headers?: [string, string][]
+	/** The body encoded as base64. */
+	body?: string
+}
+
+interface CallContent {
+	/** The path or specifier of the module. */
+	module: string
+	/** The name of the exported function. */
+	export: string
+	args: any[]
+}
+
+interface InvokeContent {
+	/** The ID of the request the call was made in, or empty. */
+	request: string
+	/** The name of the Go function. */
+	name: string
+	args?: any
+}
+
+type ImportFrame = Frame<"import", string>
+type RenderFrame = Frame<"render", RenderContent>
+type LoadFrame = Frame<"load", string>
+type CallFrame = Frame<"call", CallContent>
+type EvalFrame = Frame<"eval", string>
+type InvokeFrame = Frame<"invoke", InvokeContent>
+type FetchFrame = Frame<"fetch", FetchContent>
+type PingFrame = Frame<"ping">
+type WelcomeFrame = Frame<"welcome", { version: number }>
+
+interface ConnectionHandlers {
+	onConnect(): void
+	onData(data: string): void
+	onClose(): void
+}
+
+interface Endpoint {
+	transport: "tcp" | "unix" | "stdio"
+	/** The path of the socket for the "unix" transport. */
+	path?: string
+	/** The host for the "tcp" transport. */
+	hostname?: string
+	/** The port for the "tcp" transport. */
+	port?: number
+}
+
+interface Connection {
+	write(data: string): void
+}
+
+/** Provided by the shim of the Javascript runtime running the VM. */
+interface Runtime {
+	name: string
+	pid: number
+	heapUsed(): number
+	env(name: string): string | undefined
+	unsetEnv(name: string): void
+	connect(endpoint: Endpoint, handlers: ConnectionHandlers): Connection
+}
+
+declare const runtime: Runtime
+
+/** The content of the hello frame every worker sends first. */
+interface Handshake {
+	/** The protocol versions supported by the worker. */
+	versions: number[]
+	pid: number
+	runtime: string
+	worker: string
+	token: string
 }
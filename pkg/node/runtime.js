@@ -1,79 +1,580 @@
-import { Socket } from "node:net"
-import { pid } from "node:process"
+// The `runtime` object is declared by the shim of the Javascript runtime that
+// is running this script. See pkg/utils/nodejs.
+//
+// This script implements version 1 of the VM protocol. See
+// docs/02-vm-protocol.md.
 
-const socket = new Socket()
+import { AsyncLocalStorage } from "node:async_hooks"
+import { Buffer } from "node:buffer"
+import { format } from "node:util"
 
-function log(msg, ...args) {
-	console.log(`[runtime-v2] ${pid}: ${msg}`, ...args)
+const PROTOCOL_VERSION = 1
+
+/**
+ * The context of the request being handled.
+ *
+ * @type {AsyncLocalStorage<RequestContext>}
+ */
+const requests = new AsyncLocalStorage()
+
+// The runtime only logs what it is doing when the VM is in debug mode.
+const debug = runtime.env("GOVITE_DEBUG") === "1"
+
+/** @param {any[]} args */
+function log(...args) {
+	if (debug) {
+		emit("debug", args)
+	}
+}
+
+// Set once the VM accepted the hello of the worker.
+let welcomed = false
+
+/** The console before its calls were sent to the VM. */
+const stdio = { error: console.error.bind(console) }
+
+/**
+ * The log frames of console calls made before the VM welcomed the worker.
+ *
+ * @type {Omit<Frame, "v">[]}
+ */
+const pendingLogs = []
+
+/**
+ * Sends the console call to the VM as a log frame with the ID of the request
+ * it was made in. Until the VM welcomed the worker, the frames are kept and
+ * sent once it did.
+ *
+ * @param {LogLevel} level
+ * @param {any[]} args
+ */
+function emit(level, args) {
+	const frame = {
+		id: requests.getStore()?.id ?? "",
+		type: "log",
+		content: { level, message: format(...args) },
+	}
+
+	if (welcomed) {
+		write(frame)
+	} else if (pendingLogs.length < 1000) {
+		pendingLogs.push(frame)
+	}
 }
 
-/** @param {Result} result */
-function writeResult(result) {
-	log("Sending result:", result)
+/** @type {Record<string, LogLevel>} */
+const levels = {
+	debug: "debug",
+	trace: "debug",
+	log: "info",
+	info: "info",
+	warn: "warn",
+	error: "error",
+}
 
-	socket.write(JSON.stringify(result) + "\n")
+for (const [method, level] of Object.entries(levels)) {
+	console[method] = (...args) => emit(level, args)
 }
 
-log("Connecting to port:", process.env.PORT)
+/** @type {Map<string, Promise<any>>} */
+const modules = new Map()
 
-socket.connect(Number(process.env.PORT), () => {
-	log("Connected to port:", process.env.PORT)
+/**
+ * Imports the module once and returns the cached module on later calls.
+ *
+ * @param {string} path
+ */
+function load(path) {
+	let module = modules.get(path)
 
-	socket.on("data", async (data) => {
-		log("Received message:", data.toString("utf8"))
+	if (!module) {
+		module = import(path)
+		module.catch(() => modules.delete(path))
+		modules.set(path, module)
+	}
 
-		const messages = data.toString("utf8").split("\n")
+	return module
+}
 
-		messages.filter(Boolean).forEach(async (rawMessage) => {
-			log("Processing message:", rawMessage)
+/** @param {Omit<Frame, "v">} frame */
+function write(frame) {
+	socket.write(
+		JSON.stringify({
+			v: PROTOCOL_VERSION,
+			...frame,
+			heap: runtime.heapUsed(),
+		}) + "\n",
+	)
+}
+
+/**
+ * @param {string} id
+ * @param {any} content
+ * @param {Span[]} [spans]
+ */
+function writeResult(id, content, spans) {
+	log("Sending result:", id)
 
-			try {
-				/** @type {Message} */
-				const message = JSON.parse(rawMessage)
+	write({ id, type: "result", content, spans })
+}
 
-				if (message.type === "import") {
-					try {
-						const { default: content } = await import(message.content)
+/**
+ * @param {string} id
+ * @param {string} code
+ * @param {unknown} error
+ * @param {Span[]} [spans]
+ */
+function writeError(id, code, error, spans) {
+	log("Sending error:", id, code)
 
-						writeResult({
-							id: message.id,
-							status: "success",
-							content: await content,
-						})
-					} catch (error) {
-						writeResult({
-							id: message.id,
-							status: "error",
-							content:
-								error instanceof Error ? error.message : JSON.stringify(error),
-						})
+	write({
+		id,
+		type: "error",
+		spans,
+		error:
+			error instanceof Error
+				? {
+						code,
+						name: error.name,
+						message: error.message,
+						stack: error.stack,
 					}
-				} else if (message.type === "ping") {
-					writeResult({
-						id: message.id,
-						status: "success",
-						content: "pong",
-					})
-				} else {
-					writeResult({
-						id: message.id,
-						status: "error",
-						content: "Invalid message type",
-					})
-				}
-			} catch (error) {
-				writeResult({
-					id: "INVALID_MESSAGE",
-					status: "error",
-					content: rawMessage,
-				})
-			}
-		})
+				: {
+						code,
+						message: typeof error === "string" ? error : JSON.stringify(error),
+					},
 	})
+}
+
+const TRACEPARENT = /^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$/
+
+/**
+ * @param {string | undefined} traceparent
+ * @returns {Trace | undefined}
+ */
+function parseTraceparent(traceparent) {
+	const match = TRACEPARENT.exec(traceparent ?? "")
+
+	if (!match) {
+		return undefined
+	}
+
+	return { traceId: match[1], parentSpanId: match[2], spans: [] }
+}
+
+/** @param {number} bytes */
+function randomId(bytes) {
+	return Array.from(crypto.getRandomValues(new Uint8Array(bytes)), (byte) =>
+		byte.toString(16).padStart(2, "0"),
+	).join("")
+}
+
+function now() {
+	return performance.timeOrigin + performance.now()
+}
+
+/**
+ * Runs fn in a span of the trace of the current request. The span is sent
+ * back to the VM with the result of the request. Without a trace, fn is run
+ * as is.
+ *
+ * @template T
+ * @param {string} name
+ * @param {Record<string, any>} attributes
+ * @param {(span?: Span) => Promise<T>} fn
+ * @returns {Promise<T>}
+ */
+async function span(name, attributes, fn) {
+	const context = requests.getStore()
+
+	if (!context?.trace) {
+		return fn(undefined)
+	}
 
-	writeResult({
-		id: "INITIALIZED",
-		status: "success",
-		content: "Initialized runtime-v2",
+	/** @type {Span} */
+	const span = {
+		traceId: context.trace.traceId,
+		spanId: randomId(8),
+		parentSpanId: context.parentSpanId,
+		name,
+		start: now(),
+		end: 0,
+		attributes,
+	}
+
+	try {
+		return await requests.run({ ...context, parentSpanId: span.spanId }, () =>
+			fn(span),
+		)
+	} catch (error) {
+		span.error = error instanceof Error ? error.message : String(error)
+		throw error
+	} finally {
+		span.end = now()
+		context.trace.spans.push(span)
+	}
+}
+
+/**
+ * The requests made to the VM that were not answered yet, by the ID of their
+ * frame.
+ *
+ * @type {Map<string, { resolve(value: any): void, reject(error: Error): void }>}
+ */
+const outgoing = new Map()
+let outgoingCount = 0
+
+/**
+ * Sends a request to the VM and resolves with its result.
+ *
+ * @param {"invoke" | "fetch"} type
+ * @param {any} content
+ * @returns {Promise<any>}
+ */
+function send(type, content) {
+	const id = `${helloId}-${type}-${++outgoingCount}`
+
+	return new Promise((resolve, reject) => {
+		outgoing.set(id, { resolve, reject })
+
+		write({ id, type, content })
+	})
+}
+
+/**
+ * Settles the request to the VM answered by the frame.
+ *
+ * @param {Frame} frame
+ */
+function settle(frame) {
+	const request = outgoing.get(frame.id)
+
+	outgoing.delete(frame.id)
+
+	if (frame.type === "result") {
+		request.resolve(frame.content)
+	} else {
+		request.reject(
+			Object.assign(new Error(frame.error?.message), {
+				code: frame.error?.code,
+			}),
+		)
+	}
+}
+
+/**
+ * Calls the Go function registered under name with RegisterFunc. The Go
+ * function gets the context of the request the call is made in.
+ *
+ * @param {string} name
+ * @param {any} [args]
+ * @returns {Promise<any>}
+ */
+function call(name, args) {
+	return send("invoke", {
+		request: requests.getStore()?.id ?? "",
+		name,
+		args,
 	})
+}
+
+globalThis.govite = { ...globalThis.govite, call }
+
+// Statuses of responses that must not have a body.
+const NULL_BODY_STATUSES = [101, 204, 205, 304]
+
+/**
+ * Serves the request with the handler of the VM.
+ *
+ * @param {Request} request
+ * @returns {Promise<Response>}
+ */
+async function tunnel(request) {
+	/** @type {FetchResponse} */
+	let response
+
+	try {
+		response = await send("fetch", {
+			request: requests.getStore()?.id ?? "",
+			method: request.method,
+			url: request.url,
+			headers: [...request.headers],
+			body: request.body
+				? Buffer.from(await request.arrayBuffer()).toString("base64")
+				: undefined,
+		})
+	} catch (error) {
+		throw new TypeError("fetch failed", { cause: error })
+	}
+
+	const body =
+		response.body && !NULL_BODY_STATUSES.includes(response.status)
+			? Buffer.from(response.body, "base64")
+			: null
+
+	return new Response(body, {
+		status: response.status,
+		headers: response.headers ?? [],
+	})
+}
+
+// Relative and same-origin fetches are served by the handler of the VM, if it
+// has one, instead of going over the network.
+const bridge = runtime.env("GOVITE_FETCH") === "1"
+const fetch = globalThis.fetch
+
+globalThis.fetch = function (input, init) {
+	const context = requests.getStore()
+
+	if (bridge) {
+		const origin = context?.origin ?? "http://localhost"
+
+		if (typeof input === "string" || input instanceof URL) {
+			input = new URL(input, origin)
+		}
+
+		const request = new Request(input, init)
+
+		if (new URL(request.url).origin === origin) {
+			return traced(request, tunnel)
+		}
+
+		return traced(request, fetch)
+	}
+
+	if (!context?.trace) {
+		return fetch(input, init)
+	}
+
+	return traced(new Request(input, init), fetch)
+}
+
+/**
+ * Fetches the request with fetcher. Requests made while handling a traced
+ * request get a span of their own.
+ *
+ * @param {Request} request
+ * @param {(request: Request) => Promise<Response>} fetcher
+ * @returns {Promise<Response>}
+ */
+function traced(request, fetcher) {
+	return span(
+		"fetch",
+		{ "http.request.method": request.method, "url.full": request.url },
+		async (span) => {
+			const response = await fetcher(request)
+
+			if (span) {
+				span.attributes["http.response.status_code"] = response.status
+			}
+
+			return response
+		},
+	)
+}
+
+// The token authenticates this process to the VM. It is removed from the
+// environment so that it is not inherited by anything the render spawns.
+/** @type {Handshake} */
+const handshake = {
+	versions: [PROTOCOL_VERSION],
+	pid: runtime.pid,
+	runtime: runtime.name,
+	worker: runtime.env("GOVITE_WORKER_ID") ?? "",
+	token: runtime.env("GOVITE_TOKEN") ?? "",
+}
+
+runtime.unsetEnv("GOVITE_TOKEN")
+
+/** @returns {Endpoint} */
+function getEndpoint() {
+	const transport = runtime.env("GOVITE_TRANSPORT") ?? "tcp"
+	const address = runtime.env("GOVITE_ADDRESS") ?? ""
+
+	if (transport !== "tcp") {
+		return { transport, path: address }
+	}
+
+	const separator = address.lastIndexOf(":")
+
+	return {
+		transport,
+		hostname: address.slice(0, separator).replace(/^\[(.*)\]$/, "$1"),
+		port: Number(address.slice(separator + 1)),
+	}
+}
+
+/** @type {Record<string, (frame: Frame) => Promise<any>>} */
+const handlers = {
+	async import(frame) {
+		const { default: content } = await span("import", {}, () =>
+			import(frame.content),
+		)
+
+		return await content
+	},
+	async render(frame) {
+		const { entry, url, props, page } = frame.content
+		const { render } = await span("import", { "code.filepath": entry }, () =>
+			load(entry),
+		)
+
+		return await span("render", { "url.path": url }, () =>
+			page ? render(props, url, page) : render(props, url),
+		)
+	},
+	async load(frame) {
+		await span("import", { "code.filepath": frame.content }, () =>
+			load(frame.content),
+		)
+	},
+	async call(frame) {
+		const { module, export: name, args } = frame.content
+		const exports = await span("import", { "code.filepath": module }, () =>
+			load(module),
+		)
+
+		if (typeof exports[name] !== "function") {
+			throw new TypeError(`Module "${module}" has no exported function "${name}"`)
+		}
+
+		return await span("call", { "code.function": name }, () =>
+			exports[name](...(args ?? [])),
+		)
+	},
+	async eval(frame) {
+		// Indirect eval runs the source as a script in the global scope.
+		return await span("eval", {}, async () => (0, eval)(frame.content))
+	},
+	async ping() {
+		return "pong"
+	},
+}
+
+/** @param {Frame} frame */
+async function handleFrame(frame) {
+	const handler = handlers[frame.type]
+
+	if (!handler) {
+		writeError(frame.id, "unknown_type", `Unknown frame type "${frame.type}"`)
+		return
+	}
+
+	const trace = parseTraceparent(frame.traceparent)
+	/** @type {RequestContext} */
+	const context = {
+		id: frame.id,
+		trace,
+		parentSpanId: trace?.parentSpanId,
+		origin: frame.content?.origin,
+	}
+
+	try {
+		const content = await requests.run(context, () => handler(frame))
+
+		writeResult(frame.id, content, trace?.spans)
+	} catch (error) {
+		writeError(frame.id, "exception", error, trace?.spans)
+	}
+}
+
+/** @param {string} line */
+function handleLine(line) {
+	/** @type {Frame} */
+	let frame
+
+	try {
+		frame = JSON.parse(line)
+	} catch (error) {
+		writeError("", "invalid_frame", error)
+		return
+	}
+
+	if (typeof frame !== "object" || frame === null || !frame.id || !frame.type) {
+		writeError(
+			frame?.id ?? "",
+			"invalid_frame",
+			"Frame is missing an id or type",
+		)
+		return
+	}
+
+	if (frame.v !== PROTOCOL_VERSION) {
+		writeError(
+			frame.id,
+			"unsupported_version",
+			`Unsupported protocol version ${frame.v}`,
+		)
+		return
+	}
+
+	if (!welcomed) {
+		if (frame.type === "welcome" && frame.id === helloId) {
+			welcomed = true
+			pendingLogs.splice(0).forEach(write)
+			log("Authenticated, protocol version:", frame.content?.version)
+		} else if (frame.type === "error" && frame.id === helloId) {
+			for (const { content } of pendingLogs.splice(0)) {
+				stdio.error(content.message)
+			}
+			stdio.error("Rejected by the VM:", frame.error?.message)
+		} else {
+			writeError(frame.id, "invalid_frame", "Expected a welcome frame")
+		}
+
+		return
+	}
+
+	if (
+		(frame.type === "result" || frame.type === "error") &&
+		outgoing.has(frame.id)
+	) {
+		settle(frame)
+		return
+	}
+
+	log("Processing frame:", frame.id, frame.type)
+
+	handleFrame(frame)
+}
+
+const endpoint = getEndpoint()
+
+const helloId = `hello-${runtime.pid}-${Date.now()}`
+// Frames may arrive split across, or combined into, chunks of data. Anything
+// after the last newline is kept until the rest of the frame arrives.
+let buffer = ""
+
+log("Connecting to endpoint:", endpoint)
+
+const socket = runtime.connect(endpoint, {
+	onConnect() {
+		log("Connected to endpoint:", endpoint)
+
+		write({
+			id: helloId,
+			type: "hello",
+			content: handshake,
+		})
+	},
+	onClose() {
+		log("Connection closed")
+	},
+	onData(data) {
+		buffer += data
+
+		let index = buffer.indexOf("\n")
+
+		while (index !== -1) {
+			const line = buffer.slice(0, index).trim()
+
+			buffer = buffer.slice(index + 1)
+
+			if (line) {
+				handleLine(line)
+			}
+
+			index = buffer.indexOf("\n")
+		}
+	},
 })
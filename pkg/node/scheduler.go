@@ -0,0 +1,195 @@
+package node
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrOverloaded is matched by the errors returned for requests that were shed
+// because every worker was busy. Callers are expected to fail fast, i.e. with
+// a 503, instead of retrying immediately.
+var ErrOverloaded = errors.New("node VM is overloaded")
+
+// OverloadedError is returned for requests that could not be scheduled on a
+// worker, either because the queue was full or because they waited in it for
+// longer than the queue timeout.
+type OverloadedError struct {
+	// Reason is either "queue full" or "queue timeout".
+	Reason string
+	// Queued is the number of requests that were waiting in the queue.
+	Queued int
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("node VM is overloaded: %s with %d queued requests", e.Reason, e.Queued)
+}
+
+func (e *OverloadedError) Is(target error) bool {
+	return target == ErrOverloaded
+}
+
+// scheduler hands out connections to requests. A request is scheduled on the
+// least loaded connection that has not reached its concurrency limit. When
+// there is none, the request waits in a bounded FIFO queue until a request
+// finishes or a connection becomes available.
+type scheduler struct {
+	mutex          sync.Mutex
+	queue          *list.List
+	vm             *nodeJsVM
+	maxConcurrency int
+	maxQueueSize   int
+	queueTimeout   time.Duration
+}
+
+// waiter is a request waiting in the queue. The scheduler sends it the
+// connection it was scheduled on.
+type waiter struct {
+	connection chan *vmConnection
+	element    *list.Element
+}
+
+func newScheduler(vm *nodeJsVM) *scheduler {
+	return &scheduler{
+		queue:          list.New(),
+		vm:             vm,
+		maxConcurrency: vm.options.MaxConcurrencyPerWorker,
+		maxQueueSize:   vm.options.MaxQueueSize,
+		queueTimeout:   vm.options.QueueTimeout,
+	}
+}
+
+// Acquire returns the connection the request was scheduled on. The caller
+// must call Release with it once the request finished.
+func (s *scheduler) Acquire(ctx context.Context) (*vmConnection, error) {
+	if s.vm.isStopping() {
+		return nil, ErrShuttingDown
+	}
+
+	s.mutex.Lock()
+
+	if s.queue.Len() == 0 {
+		if connection := s.leastLoaded(); connection != nil {
+			connection.scheduled++
+			s.mutex.Unlock()
+
+			return connection, nil
+		}
+	}
+
+	if s.queue.Len() >= s.maxQueueSize {
+		queued := s.queue.Len()
+		s.mutex.Unlock()
+
+		return nil, &OverloadedError{Reason: "queue full", Queued: queued}
+	}
+
+	w := &waiter{connection: make(chan *vmConnection, 1)}
+	w.element = s.queue.PushBack(w)
+
+	s.mutex.Unlock()
+
+	timer := time.NewTimer(s.queueTimeout)
+	defer timer.Stop()
+
+	var err error
+
+	select {
+	case connection := <-w.connection:
+		return connection, nil
+	case <-timer.C:
+		err = &OverloadedError{Reason: "queue timeout", Queued: s.Queued()}
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-s.vm.closed:
+		err = net.ErrClosed
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if w.element != nil {
+		s.queue.Remove(w.element)
+
+		return nil, err
+	}
+
+	// The waiter was scheduled while giving up, so its connection is handed
+	// to the next request.
+	connection := <-w.connection
+	connection.scheduled--
+	s.dispatch()
+
+	return nil, err
+}
+
+// Release marks the request scheduled on the connection as finished and
+// schedules the next queued request.
+func (s *scheduler) Release(connection *vmConnection) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	connection.scheduled--
+
+	s.dispatch()
+}
+
+// Dispatch schedules queued requests on the available connections. It is
+// called whenever the connections of the VM change.
+func (s *scheduler) Dispatch() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.dispatch()
+}
+
+// Queued returns the number of requests waiting in the queue.
+func (s *scheduler) Queued() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.queue.Len()
+}
+
+// dispatch must be called with the mutex held.
+func (s *scheduler) dispatch() {
+	for s.queue.Len() > 0 {
+		connection := s.leastLoaded()
+		if connection == nil {
+			return
+		}
+
+		w := s.queue.Remove(s.queue.Front()).(*waiter)
+		w.element = nil
+
+		connection.scheduled++
+		w.connection <- connection
+	}
+}
+
+// leastLoaded returns the connection with the fewest scheduled requests that
+// can take another one, or nil if there is none. It must be called with the
+// mutex held.
+func (s *scheduler) leastLoaded() *vmConnection {
+	var found *vmConnection
+
+	s.vm.connections.Range(func(_ any, value any) bool {
+		connection := value.(*vmConnection)
+
+		if connection.Draining.Load() || connection.isClosed() || connection.scheduled >= s.maxConcurrency {
+			return true
+		}
+
+		if found == nil || connection.scheduled < found.scheduled {
+			found = connection
+		}
+
+		return true
+	})
+
+	return found
+}
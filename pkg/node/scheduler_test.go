@@ -0,0 +1,93 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSchedulerSheds(t *testing.T) {
+	vm := newTestVM(t, Options{
+		MaxConcurrencyPerWorker: 1,
+		MaxQueueSize:            1,
+		QueueTimeout:            200 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The only slot is taken by a render that never finishes.
+	go vm.Render(ctx, testEntry(t), "/", map[string]any{"hang": true})
+
+	waitFor(t, 5*time.Second, func() bool { return vm.workers[0].Connection().GetPendingRequests() == 1 })
+
+	queued := make(chan error, 1)
+
+	go func() {
+		_, err := vm.Render(context.Background(), testEntry(t), "/", nil)
+		queued <- err
+	}()
+
+	waitFor(t, 5*time.Second, func() bool { return vm.Stats().Queued == 1 })
+
+	_, err := vm.Render(context.Background(), testEntry(t), "/", nil)
+
+	var overloaded *OverloadedError
+	if !errors.As(err, &overloaded) || overloaded.Reason != "queue full" || !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("expected a full queue, got %v", err)
+	}
+
+	select {
+	case err := <-queued:
+		if !errors.As(err, &overloaded) || overloaded.Reason != "queue timeout" {
+			t.Fatalf("expected a queue timeout, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued render did not time out")
+	}
+}
+
+func TestSchedulerQueuesUntilRelease(t *testing.T) {
+	vm := newTestVM(t, Options{MaxConcurrencyPerWorker: 1})
+
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := vm.Render(context.Background(), testEntry(t), "/", map[string]any{"sleep": 200})
+		done <- err
+	}()
+
+	waitFor(t, 5*time.Second, func() bool { return vm.workers[0].Connection().GetPendingRequests() == 1 })
+
+	start := time.Now()
+
+	if _, err := vm.Render(context.Background(), testEntry(t), "/", nil); err != nil {
+		t.Fatalf("queued render failed: %v", err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("first render failed: %v", err)
+	}
+
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Fatalf("expected the render to wait for the first one, waited %s", waited)
+	}
+}
+
+func TestSchedulerSpreadsLoad(t *testing.T) {
+	vm := newTestVM(t, Options{NodeProcesses: 2, MaxConcurrencyPerWorker: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		go vm.Render(ctx, testEntry(t), "/", map[string]any{"hang": true})
+	}
+
+	waitFor(t, 5*time.Second, func() bool {
+		stats := vm.Stats()
+
+		return stats.Workers[0].InFlight == 1 && stats.Workers[1].InFlight == 1
+	})
+}
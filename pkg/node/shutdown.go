@@ -0,0 +1,200 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/lukeshay/govite/pkg/utils/nodejs"
+)
+
+// ErrShuttingDown is returned for requests made after Shutdown was called.
+var ErrShuttingDown = errors.New("node VM is shutting down")
+
+// PendingRequest is a request that was still pending when the VM shut down.
+type PendingRequest struct {
+	// ID is the ID of the request.
+	ID string
+	// Type is the type of the request, i.e. "render".
+	Type string
+	// Worker is the index of the worker the request was scheduled on. It is
+	// -1 if the request was still queued.
+	Worker int
+	// Age is the time since the request was made.
+	Age time.Duration
+}
+
+// ShutdownError is returned by Shutdown when requests were still pending when
+// the context was done. They fail once the worker processes are stopped.
+type ShutdownError struct {
+	// Pending are the requests that were still pending.
+	Pending []PendingRequest
+	// Err is the error of the context.
+	Err error
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("node VM shut down with %d pending requests: %v", len(e.Pending), e.Err)
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// pendingRequest tracks a request from the moment it is made until it is
+// answered.
+type pendingRequest struct {
+	// ctx is the context of the request, given to the Funcs it calls.
+	ctx       context.Context
+	id        string
+	kind      string
+	startedAt time.Time
+	worker    atomic.Int64
+}
+
+func (vm *nodeJsVM) isStopping() bool {
+	select {
+	case <-vm.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shutdown stops accepting requests and waits for the pending ones to finish
+// or the context to be done. The worker processes are then sent SIGTERM and
+// killed with their process group if they did not exit after
+// Options.TerminateTimeout or once the context is done, whichever is first.
+// If the context was done before, they are killed right away.
+func (vm *nodeJsVM) Shutdown(ctx context.Context) error {
+	vm.stopOnce.Do(func() { close(vm.stopping) })
+
+	vm.log.Debug("Shutting down node processes", "pending", vm.GetPendingRequests())
+
+	var result *ShutdownError
+
+	if err := vm.waitForPendingRequests(ctx); err != nil {
+		result = &ShutdownError{Pending: vm.pendingRequests(), Err: err}
+
+		vm.log.Info("Shutting down with pending requests", "pending", len(result.Pending), "error", err)
+	}
+
+	vm.stopProcesses(ctx, vm.runningProcesses()...)
+
+	if err := vm.Close(); err != nil {
+		return err
+	}
+
+	if result != nil {
+		return result
+	}
+
+	return nil
+}
+
+func (vm *nodeJsVM) waitForPendingRequests(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for vm.GetPendingRequests() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (vm *nodeJsVM) pendingRequests() []PendingRequest {
+	var pending []PendingRequest
+
+	vm.pending.Range(func(_ any, value any) bool {
+		request := value.(*pendingRequest)
+
+		pending = append(pending, PendingRequest{
+			ID:     request.id,
+			Type:   request.kind,
+			Worker: int(request.worker.Load()),
+			Age:    time.Since(request.startedAt),
+		})
+
+		return true
+	})
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Age > pending[j].Age
+	})
+
+	return pending
+}
+
+func (vm *nodeJsVM) runningProcesses() []*process {
+	var processes []*process
+
+	vm.running.Range(func(_ any, value any) bool {
+		processes = append(processes, value.(*process))
+
+		return true
+	})
+
+	return processes
+}
+
+// stopProcesses sends SIGTERM to the processes and kills the ones that did not
+// exit after the terminate timeout or once the context is done. If the
+// context is already done, the processes are killed without SIGTERM.
+func (vm *nodeJsVM) stopProcesses(ctx context.Context, processes ...*process) {
+	ctx, cancel := context.WithTimeout(ctx, vm.options.TerminateTimeout)
+	defer cancel()
+
+	timedOut := ctx.Err() != nil
+
+	if !timedOut {
+		for _, p := range processes {
+			if err := nodejs.Terminate(p.cmd); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				p.worker.log.Debug("Error terminating node process", "pid", p.PID(), "error", err)
+			}
+		}
+	}
+
+	for _, p := range processes {
+		if !timedOut {
+			select {
+			case <-p.exited:
+				continue
+			case <-ctx.Done():
+				timedOut = true
+			}
+		}
+
+		select {
+		case <-p.exited:
+			continue
+		default:
+		}
+
+		p.worker.log.Info("Killing node process that did not exit", "pid", p.PID())
+
+		killProcesses(p)
+	}
+}
+
+// killProcesses kills the processes with their process groups.
+func killProcesses(processes ...*process) error {
+	var result *multierror.Error
+
+	for _, p := range processes {
+		if err := nodejs.Kill(p.cmd); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	return result.ErrorOrNil()
+}
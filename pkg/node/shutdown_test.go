@@ -0,0 +1,133 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	vm := newTestVM(t)
+
+	rendered := make(chan error, 1)
+
+	go func() {
+		_, err := vm.Render(context.Background(), testEntry(t), "/", map[string]any{"sleep": 300})
+		rendered <- err
+	}()
+
+	waitFor(t, 5*time.Second, func() bool { return vm.GetPendingRequests() == 1 })
+
+	processes := vm.runningProcesses()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := vm.Shutdown(ctx); err != nil {
+		t.Fatalf("could not shut down: %v", err)
+	}
+
+	if err := <-rendered; err != nil {
+		t.Errorf("expected the pending render to finish, got %v", err)
+	}
+
+	for _, p := range processes {
+		select {
+		case <-p.exited:
+		default:
+			t.Errorf("expected process %d to have exited", p.PID())
+		}
+	}
+
+	if _, err := vm.Render(context.Background(), testEntry(t), "/", nil); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("expected %v after shutdown, got %v", ErrShuttingDown, err)
+	}
+}
+
+func TestShutdownReportsPendingRequests(t *testing.T) {
+	vm := newTestVM(t, Options{TerminateTimeout: 100 * time.Millisecond})
+
+	rendered := make(chan error, 1)
+
+	go func() {
+		_, err := vm.Render(context.Background(), testEntry(t), "/", map[string]any{"hang": true})
+		rendered <- err
+	}()
+
+	waitFor(t, 5*time.Second, func() bool { return vm.GetPendingRequests() == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := vm.Shutdown(ctx)
+
+	var shutdownErr *ShutdownError
+	if !errors.As(err, &shutdownErr) {
+		t.Fatalf("expected a ShutdownError, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the error to wrap %v, got %v", context.DeadlineExceeded, err)
+	}
+	if len(shutdownErr.Pending) != 1 {
+		t.Fatalf("expected 1 pending request, got %+v", shutdownErr.Pending)
+	}
+	if pending := shutdownErr.Pending[0]; pending.Type != "render" || pending.Worker != 0 {
+		t.Errorf("unexpected pending request %+v", pending)
+	}
+
+	select {
+	case err := <-rendered:
+		if err == nil {
+			t.Error("expected the pending render to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected the pending render to fail once its worker stopped")
+	}
+}
+
+func TestShutdownKillsByTheContextDeadline(t *testing.T) {
+	tests := []struct {
+		name  string
+		props map[string]any
+	}{
+		{name: "idle"},
+		{name: "pending", props: map[string]any{"hang": true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := newTestVM(t, Options{
+				Flags:            []string{"--require", "./ignore_sigterm.cjs"},
+				TerminateTimeout: time.Minute,
+			})
+
+			if tt.props != nil {
+				go vm.Render(context.Background(), testEntry(t), "/", tt.props)
+
+				waitFor(t, 5*time.Second, func() bool { return vm.GetPendingRequests() == 1 })
+			}
+
+			processes := vm.runningProcesses()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+
+			vm.Shutdown(ctx)
+
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("expected shutdown to end by the deadline, took %v", elapsed)
+			}
+
+			for _, p := range processes {
+				select {
+				case <-p.exited:
+				case <-time.After(5 * time.Second):
+					t.Errorf("expected process %d to be killed", p.PID())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+export async function render(props, url, page) {
+	if (props?.sleep) {
+		await new Promise((resolve) => setTimeout(resolve, props.sleep))
+	}
+	if (props?.hang) {
+		await new Promise(() => {})
+	}
+	if (props?.loop) {
+		for (;;) {}
+	}
+	if (props?.throw) {
+		throw new Error(props.throw)
+	}
+	if (props?.log) {
+		console.warn(props.log)
+	}
+	if (props?.fetch) {
+		return await get(props.fetch)
+	}
+
+	return { html: `<p>${url}</p>`, props, page }
+}
+
+export function add(a, b) {
+	return a + b
+}
+
+export async function call(name, args) {
+	return await govite.call(name, args)
+}
+
+export async function code(name, args) {
+	try {
+		await govite.call(name, args)
+	} catch (error) {
+		return error.code
+	}
+}
+
+export async function get(path) {
+	const response = await fetch(path)
+
+	return { status: response.status, body: await response.text() }
+}
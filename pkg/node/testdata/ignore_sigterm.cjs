@@ -0,0 +1 @@
+process.on("SIGTERM", () => {})
@@ -0,0 +1 @@
+globalThis.loaded = (globalThis.loaded ?? 0) + 1
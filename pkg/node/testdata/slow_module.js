@@ -0,0 +1,5 @@
+import { appendFileSync } from "node:fs"
+
+appendFileSync(process.env.GOVITE_TEST_IMPORTS, `${process.pid}\n`)
+
+await new Promise((resolve) => setTimeout(resolve, 500))
@@ -0,0 +1,98 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRenderTimeoutReplacesWorker(t *testing.T) {
+	vm := newTestVM(t, Options{RenderTimeout: 300 * time.Millisecond, RestartBackoff: 10 * time.Millisecond})
+
+	w := vm.workers[0]
+	pid := w.PID()
+	ctx := context.Background()
+
+	timedOut := make(chan error, 1)
+
+	go func() {
+		_, err := vm.Render(ctx, testEntry(t), "/", map[string]any{"loop": true})
+		timedOut <- err
+	}()
+
+	waitFor(t, 5*time.Second, func() bool { return vm.GetPendingRequests() == 1 })
+
+	// The render is sent after the hung one, so it is in-flight on the same
+	// process when it is killed.
+	if _, err := vm.Render(ctx, testEntry(t), "/", nil); err != nil {
+		t.Errorf("expected the other in-flight render to be retried, got %v", err)
+	}
+
+	err := <-timedOut
+
+	var timeoutErr *RenderTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected a RenderTimeoutError, got %v", err)
+	}
+	if !errors.Is(err, ErrRenderTimeout) {
+		t.Errorf("expected the error to match %v", ErrRenderTimeout)
+	}
+	if timeoutErr.PID != pid || timeoutErr.Timeout != 300*time.Millisecond {
+		t.Errorf("unexpected error %+v, expected pid %d", timeoutErr, pid)
+	}
+
+	waitFor(t, 5*time.Second, func() bool { return w.Restarts() == 1 })
+
+	readyCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := vm.Ready(readyCtx); err != nil {
+		t.Fatalf("replaced worker did not become ready: %v", err)
+	}
+	if w.PID() == pid {
+		t.Fatalf("expected the worker to be replaced, got pid %d again", pid)
+	}
+
+	if _, err := vm.Render(readyCtx, testEntry(t), "/", nil); err != nil {
+		t.Errorf("could not render on the replaced worker: %v", err)
+	}
+}
+
+func TestRenderTimeoutAllowsFastRenders(t *testing.T) {
+	vm := newTestVM(t, Options{RenderTimeout: time.Second})
+
+	pid := vm.workers[0].PID()
+
+	if _, err := vm.Render(context.Background(), testEntry(t), "/", map[string]any{"sleep": 50}); err != nil {
+		t.Fatalf("could not render: %v", err)
+	}
+
+	if vm.workers[0].PID() != pid {
+		t.Error("expected the worker to be kept")
+	}
+}
+
+func TestV8Flags(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		want    []string
+	}{
+		{name: "none", options: Options{}, want: nil},
+		{
+			name:    "limits",
+			options: Options{MaxOldSpaceSize: 512, MaxSemiSpaceSize: 16, V8Flags: []string{"--stack-size=2048"}},
+			want:    []string{"--max-old-space-size=512", "--max-semi-space-size=16", "--stack-size=2048"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.v8Flags(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package node
+
+import (
+	"context"
+
+	"github.com/lukeshay/govite/internal/protocol"
+)
+
+// Tracer creates the spans of the requests handled by the VM and exports the
+// spans recorded by the workers. It lets packages like pkg/otel trace requests
+// without the VM depending on a tracing library.
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx. The returned context
+	// carries the new span and end must be called once the operation is done.
+	Start(ctx context.Context, name string, attributes map[string]any) (_ context.Context, end func(err error))
+	// Traceparent returns the W3C traceparent of the span in ctx. Workers only
+	// record spans for requests with a traceparent, so an empty string turns
+	// tracing off for the request.
+	Traceparent(ctx context.Context) string
+	// Export records the spans a worker recorded while handling the request of
+	// the span in ctx.
+	Export(ctx context.Context, spans []Span)
+}
+
+// Span is a span recorded by a worker, i.e. around the import of the server
+// entry, the call to render or a fetch made while rendering.
+type Span = protocol.Span
+
+// startSpan starts a span with the tracer of the options, if any.
+func (vm *nodeJsVM) startSpan(ctx context.Context, name string, attributes map[string]any) (context.Context, func(err error)) {
+	if vm.options.Tracer == nil {
+		return ctx, func(error) {}
+	}
+
+	return vm.options.Tracer.Start(ctx, name, attributes)
+}
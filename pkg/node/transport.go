@@ -0,0 +1,227 @@
+package node
+
+import (
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Transport connects the VM to its worker processes. Workers are told how to
+// reach the transport through the GOVITE_TRANSPORT and GOVITE_ADDRESS
+// environment variables.
+type Transport interface {
+	// Name returns the name of the transport, i.e. "tcp".
+	Name() string
+	// Prepare configures the command of a worker before it is started so that
+	// the worker is able to connect to the transport. If the transport already
+	// has a connection to the worker, it is returned and the worker will not
+	// be received through Accept.
+	Prepare(cmd *exec.Cmd) (net.Conn, error)
+	// Accept blocks until a worker connects to the transport. It returns
+	// net.ErrClosed once the transport is closed.
+	Accept() (net.Conn, error)
+	// Close closes the transport and releases its resources.
+	Close() error
+}
+
+type listenerTransport struct {
+	name     string
+	listener net.Listener
+	address  string
+	cleanup  func() error
+}
+
+// NewTCPTransport returns a Transport listening on the given TCP address.
+// Workers connect to the address the listener was bound to, so a port of 0
+// picks an ephemeral port.
+func NewTCPTransport(address string) (Transport, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listenerTransport{
+		name:     "tcp",
+		listener: listener,
+		address:  listener.Addr().String(),
+	}, nil
+}
+
+// NewUnixTransport returns a Transport listening on a Unix domain socket in a
+// private temporary directory that is removed when the transport is closed.
+func NewUnixTransport() (Transport, error) {
+	dir, err := os.MkdirTemp("", "govite-*")
+	if err != nil {
+		return nil, err
+	}
+
+	address := filepath.Join(dir, "vm.sock")
+
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	return &listenerTransport{
+		name:     "unix",
+		listener: listener,
+		address:  address,
+		cleanup: func() error {
+			return os.RemoveAll(dir)
+		},
+	}, nil
+}
+
+func (t *listenerTransport) Name() string {
+	return t.name
+}
+
+func (t *listenerTransport) Prepare(cmd *exec.Cmd) (net.Conn, error) {
+	cmd.Env = append(cmd.Env, "GOVITE_TRANSPORT="+t.name, "GOVITE_ADDRESS="+t.address)
+
+	return nil, nil
+}
+
+func (t *listenerTransport) Accept() (net.Conn, error) {
+	return t.listener.Accept()
+}
+
+func (t *listenerTransport) Close() error {
+	err := t.listener.Close()
+
+	if t.cleanup != nil {
+		if cleanupErr := t.cleanup(); err == nil {
+			err = cleanupErr
+		}
+	}
+
+	return err
+}
+
+type stdioTransport struct {
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewStdioTransport returns a Transport that talks to every worker over its
+// stdin and stdout, so no ports or files are needed. The console output of
+// the workers is written to stderr instead.
+func NewStdioTransport() Transport {
+	return &stdioTransport{
+		closed: make(chan struct{}),
+	}
+}
+
+func (t *stdioTransport) Name() string {
+	return "stdio"
+}
+
+func (t *stdioTransport) Prepare(cmd *exec.Cmd) (net.Conn, error) {
+	cmd.Env = append(cmd.Env, "GOVITE_TRANSPORT=stdio")
+	cmd.Stdin = nil
+	cmd.Stdout = nil
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		stdin.Close()
+		return nil, err
+	}
+
+	return &pipeConn{reader: stdout, writer: stdin}, nil
+}
+
+func (t *stdioTransport) Accept() (net.Conn, error) {
+	<-t.closed
+
+	return nil, net.ErrClosed
+}
+
+func (t *stdioTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+
+	return nil
+}
+
+// pipeConn is a net.Conn over the stdin and stdout pipes of a worker. The
+// pipes of a command do not support deadlines on every platform, so a read
+// deadline closes the stdout pipe once it passes instead. The connection
+// cannot be used after that.
+type pipeConn struct {
+	reader    io.ReadCloser
+	writer    io.WriteCloser
+	mutex     sync.Mutex
+	readTimer *time.Timer
+	expired   atomic.Bool
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "stdio" }
+func (pipeAddr) String() string  { return "stdio" }
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	n, err := c.reader.Read(b)
+	if err != nil && c.expired.Load() {
+		err = os.ErrDeadlineExceeded
+	}
+
+	return n, err
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) { return c.writer.Write(b) }
+
+func (c *pipeConn) Close() error {
+	c.SetReadDeadline(time.Time{})
+
+	werr := c.writer.Close()
+	rerr := c.reader.Close()
+
+	if werr != nil {
+		return werr
+	}
+
+	return rerr
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return pipeAddr{} }
+func (c *pipeConn) RemoteAddr() net.Addr { return pipeAddr{} }
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.readTimer != nil {
+		c.readTimer.Stop()
+		c.readTimer = nil
+	}
+
+	if t.IsZero() || c.expired.Load() {
+		return nil
+	}
+
+	c.readTimer = time.AfterFunc(time.Until(t), func() {
+		c.expired.Store(true)
+		c.reader.Close()
+	})
+
+	return nil
+}
+
+// SetWriteDeadline is not supported. Writes to a worker that stopped reading
+// fail once its process exits.
+func (c *pipeConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,136 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lukeshay/govite/pkg/utils/nodejs"
+)
+
+func TestTransports(t *testing.T) {
+	transports := map[string]func() (Transport, error){
+		"tcp":   func() (Transport, error) { return NewTCPTransport("localhost:0") },
+		"unix":  NewUnixTransport,
+		"stdio": func() (Transport, error) { return NewStdioTransport(), nil },
+	}
+
+	for name, newTransport := range transports {
+		t.Run(name, func(t *testing.T) {
+			transport, err := newTransport()
+			if err != nil {
+				t.Fatalf("could not create transport: %v", err)
+			}
+
+			vm := newTestVM(t, Options{Transport: transport, NodeProcesses: 2})
+
+			result, err := vm.Render(context.Background(), testEntry(t), "/", map[string]any{"log": "hello"})
+			if err != nil {
+				t.Fatalf("could not render: %v", err)
+			}
+
+			if html := result.(map[string]any)["html"]; html != "<p>/</p>" {
+				t.Errorf("unexpected html %v", html)
+			}
+		})
+	}
+}
+
+func TestPipeConnReadDeadline(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := &pipeConn{reader: reader, writer: writer}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+
+	errs := make(chan error, 1)
+
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		errs <- err
+	}()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("expected os.ErrDeadlineExceeded, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read did not time out")
+	}
+}
+
+func TestPipeConnClearedReadDeadline(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := &pipeConn{reader: reader, writer: writer}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	conn.SetReadDeadline(time.Time{})
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := writer.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("expected the read to succeed, got %v", err)
+	}
+}
+
+// silentRuntime is node, except that its workers never say hello while
+// silent is set.
+type silentRuntime struct {
+	nodejs.NodeRuntime
+	silent atomic.Bool
+}
+
+func (r *silentRuntime) Command(options nodejs.NodeJSCommandOptions) *exec.Cmd {
+	if r.silent.Load() {
+		// The connect call is short-circuited, so the worker is kept alive
+		// without ever sending its hello.
+		options.Script = strings.Replace(options.Script, "const socket = runtime.connect(", "setInterval(() => {}, 1000)\nconst socket = ({ write() {} }) ?? (", 1)
+	}
+
+	return r.NodeRuntime.Command(options)
+}
+
+func TestStdioHandshakeTimeout(t *testing.T) {
+	timeout := handshakeTimeout
+	handshakeTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { handshakeTimeout = timeout })
+
+	runtime := &silentRuntime{}
+
+	vm := newTestVM(t, Options{Runtime: runtime, Transport: NewStdioTransport()})
+
+	runtime.silent.Store(true)
+
+	w := vm.workers[0]
+	pid := w.PID()
+
+	if err := killProcesses(w.Process()); err != nil {
+		t.Fatalf("could not kill worker: %v", err)
+	}
+
+	// The silent process is killed once the handshake timed out, and is
+	// restarted in turn.
+	waitFor(t, 5*time.Second, func() bool { return w.Restarts() >= 2 })
+
+	if w.PID() == pid {
+		t.Fatalf("expected a new process, got pid %d again", pid)
+	}
+}
@@ -0,0 +1,435 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lukeshay/govite/internal/protocol"
+	"github.com/lukeshay/govite/pkg/utils/nodejs"
+	"github.com/rs/xid"
+)
+
+// ErrWorkerExited is matched by the errors returned for requests whose worker
+// exited before answering them.
+var ErrWorkerExited = errors.New("node worker exited")
+
+// WorkerExitError is returned for the in-flight requests of a worker that
+// exited or lost its connection before answering them.
+type WorkerExitError struct {
+	// PID is the process ID of the worker.
+	PID int
+	// Err is the reason the worker exited.
+	Err error
+}
+
+func (e *WorkerExitError) Error() string {
+	return fmt.Sprintf("node worker %d exited: %v", e.PID, e.Err)
+}
+
+func (e *WorkerExitError) Unwrap() error {
+	return e.Err
+}
+
+func (e *WorkerExitError) Is(target error) bool {
+	return target == ErrWorkerExited
+}
+
+// ErrRenderTimeout is matched by the errors returned for renders that missed
+// Options.RenderTimeout.
+var ErrRenderTimeout = errors.New("node render timed out")
+
+// RenderTimeoutError is returned for a render that missed
+// Options.RenderTimeout. The worker running it was killed and replaced.
+type RenderTimeoutError struct {
+	// PID is the process ID of the worker that was killed.
+	PID int
+	// Timeout is the render timeout that was missed.
+	Timeout time.Duration
+}
+
+func (e *RenderTimeoutError) Error() string {
+	return fmt.Sprintf("node render did not finish within %s, killed worker %d", e.Timeout, e.PID)
+}
+
+func (e *RenderTimeoutError) Is(target error) bool {
+	return target == ErrRenderTimeout
+}
+
+// process is a single node process filling a worker.
+type process struct {
+	id         string
+	token      string
+	worker     *worker
+	cmd        *exec.Cmd
+	connection *vmConnection
+	startedAt  time.Time
+	requests   int64
+	heap       int64
+	retired    bool
+	// exited is closed once the process exited.
+	exited chan struct{}
+	// killedFor is the ID of the render the process was killed for because it
+	// missed the render timeout.
+	killedFor atomic.Pointer[string]
+	// ageTimer recycles the process once it reached Options.MaxWorkerAge. It
+	// is guarded by the mutex of the worker.
+	ageTimer *time.Timer
+}
+
+func (p *process) PID() int {
+	return p.cmd.Process.Pid
+}
+
+// worker is a slot of the VM that is always filled by a node process. When the
+// process exits the supervisor starts a new one in its place. When the process
+// reaches one of the recycling limits a replacement is started and swapped in
+// once it is initialized.
+type worker struct {
+	mutex       sync.Mutex
+	index       int
+	process     *process
+	replacement *process
+	backoff     time.Duration
+	restarts    int64
+	recycles    int64
+	log         *slog.Logger
+}
+
+// Process returns the process currently serving the worker. It is nil while
+// the worker is restarting.
+func (w *worker) Process() *process {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.process
+}
+
+func (w *worker) PID() int {
+	if p := w.Process(); p != nil {
+		return p.PID()
+	}
+
+	return 0
+}
+
+func (w *worker) Connection() *vmConnection {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.process == nil {
+		return nil
+	}
+
+	return w.process.connection
+}
+
+func (w *worker) Restarts() int64 {
+	return atomic.LoadInt64(&w.restarts)
+}
+
+func (w *worker) Recycles() int64 {
+	return atomic.LoadInt64(&w.recycles)
+}
+
+func (vm *nodeJsVM) newCommand(w *worker) *exec.Cmd {
+	cmd := nodejs.NewNodeJSCommand(nodejs.NodeJSCommandOptions{
+		Runtime: vm.runtime,
+		Script:  vm.script,
+		Dir:     vm.options.Dir,
+		Stdout:  vm.options.Stdout,
+		Stderr:  vm.options.Stderr,
+		Flags:   vm.options.Flags,
+		V8Flags: vm.options.v8Flags(),
+	})
+
+	if cmd.Stdout == nil {
+		cmd.Stdout = newLogWriter(w.log, slog.LevelInfo, "stdout", cmd)
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = newLogWriter(w.log, slog.LevelError, "stderr", cmd)
+	}
+
+	cmd.Env = append(cmd.Env, vm.options.Env...)
+
+	nodejs.SetProcessGroup(cmd)
+
+	if vm.options.Debug {
+		cmd.Env = append(cmd.Env, "GOVITE_DEBUG=1")
+	}
+	if vm.options.Handler != nil {
+		cmd.Env = append(cmd.Env, "GOVITE_FETCH=1")
+	}
+
+	return cmd
+}
+
+// startProcess starts a new node process for the worker and supervises it.
+// The caller must hold the worker's mutex.
+func (vm *nodeJsVM) startProcess(w *worker) (*process, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	id := xid.New().String()
+
+	cmd := vm.newCommand(w)
+	cmd.Env = append(cmd.Env, "GOVITE_WORKER_ID="+id, "GOVITE_TOKEN="+token)
+
+	conn, err := vm.transport.Prepare(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+
+		return nil, err
+	}
+
+	p := &process{
+		id:        id,
+		token:     token,
+		worker:    w,
+		cmd:       cmd,
+		startedAt: time.Now(),
+		exited:    make(chan struct{}),
+	}
+
+	vm.processes.Store(id, p)
+	vm.running.Store(id, p)
+
+	w.log.Debug("Started node process", "pid", p.PID(), "process", id)
+
+	go vm.supervise(p)
+
+	if conn != nil {
+		go vm.handleConnection(newVMConnection(conn, vm.log), p)
+	}
+
+	if vm.options.MaxWorkerAge > 0 {
+		p.ageTimer = time.AfterFunc(vm.options.MaxWorkerAge, func() {
+			vm.recycle(p, "age")
+		})
+	}
+
+	return p, nil
+}
+
+func (vm *nodeJsVM) startWorker(w *worker) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if vm.isStopping() {
+		return net.ErrClosed
+	}
+
+	p, err := vm.startProcess(w)
+	if err != nil {
+		return err
+	}
+
+	w.process = p
+
+	return nil
+}
+
+// supervise waits for the process to exit and fails its in-flight requests.
+// If the process was serving its worker and was not retired, its replacement
+// takes over if it is being recycled, or a new process is started with
+// exponential backoff until the VM is closed.
+func (vm *nodeJsVM) supervise(p *process) {
+	w := p.worker
+
+	err := p.cmd.Wait()
+	if err == nil {
+		err = errors.New("process exited")
+	}
+
+	close(p.exited)
+
+	vm.processes.Delete(p.id)
+	vm.running.Delete(p.id)
+
+	w.mutex.Lock()
+	connection := p.connection
+	retired := p.retired
+	current := w.process == p
+	promoted := current && w.replacement != nil
+	if promoted {
+		w.process = w.replacement
+		w.replacement = nil
+	} else if current {
+		w.process = nil
+	}
+	if w.replacement == p {
+		w.replacement = nil
+
+		// The process it was replacing is recycled again later, as it would
+		// never reach its age again.
+		vm.retryAgeRecycle(w.process)
+	}
+	if p.ageTimer != nil {
+		p.ageTimer.Stop()
+	}
+	w.mutex.Unlock()
+
+	if connection != nil {
+		connection.CloseWithError(&WorkerExitError{PID: p.PID(), Err: err})
+		vm.removeConnection(connection)
+	}
+
+	if retired || !current || vm.isStopping() {
+		w.log.Debug("Node process stopped", "pid", p.PID(), "error", err)
+
+		return
+	}
+
+	if promoted {
+		w.log.Info("Node process exited while it was recycled, its replacement takes over", "pid", p.PID(), "error", err)
+
+		atomic.AddInt64(&w.restarts, 1)
+
+		vm.notifyChanged()
+
+		return
+	}
+
+	if time.Since(p.startedAt) >= vm.options.MaxRestartBackoff || w.backoff == 0 {
+		w.backoff = vm.options.RestartBackoff
+	}
+
+	w.log.Info("Node process exited", "pid", p.PID(), "error", err, "backoff", w.backoff)
+
+	for {
+		select {
+		case <-time.After(w.backoff):
+		case <-vm.closed:
+			return
+		}
+
+		w.backoff = min(w.backoff*2, vm.options.MaxRestartBackoff)
+
+		if err := vm.startWorker(w); err != nil {
+			w.log.Info("Error starting node process", "error", err, "backoff", w.backoff)
+
+			continue
+		}
+
+		break
+	}
+
+	atomic.AddInt64(&w.restarts, 1)
+
+	vm.notifyChanged()
+}
+
+// killHungProcess kills the process of the connection because the render with
+// the given ID missed the render timeout. A render that does not finish may
+// block the event loop of the process, so it cannot be cancelled otherwise.
+// The worker is restarted by its supervisor.
+func (vm *nodeJsVM) killHungProcess(connection *vmConnection, id string) {
+	p := connection.process.Load()
+	if p == nil || !p.killedFor.CompareAndSwap(nil, &id) {
+		return
+	}
+
+	connection.Draining.Store(true)
+
+	p.worker.log.Info("Killing node process that missed the render timeout", "pid", p.PID(), "request", id, "timeout", vm.options.RenderTimeout)
+
+	if err := killProcesses(p); err != nil {
+		p.worker.log.Debug("Error killing node process", "pid", p.PID(), "error", err)
+	}
+}
+
+// afterRequest records a finished request of the connection and recycles its
+// process when it reached one of the limits in the options.
+func (vm *nodeJsVM) afterRequest(connection *vmConnection, result protocol.Frame) {
+	p := connection.process.Load()
+	if p == nil {
+		return
+	}
+
+	requests := atomic.AddInt64(&p.requests, 1)
+
+	if result.Heap > 0 {
+		atomic.StoreInt64(&p.heap, result.Heap)
+	}
+
+	switch {
+	case vm.options.MaxRequestsPerWorker > 0 && requests >= vm.options.MaxRequestsPerWorker:
+		go vm.recycle(p, "requests")
+	case vm.options.MaxWorkerHeap > 0 && result.Heap >= vm.options.MaxWorkerHeap:
+		go vm.recycle(p, "heap")
+	}
+}
+
+// recycle starts a replacement for the process. The process keeps serving
+// until the replacement is initialized and is then drained and stopped.
+func (vm *nodeJsVM) recycle(p *process, reason string) {
+	w := p.worker
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if vm.isStopping() || w.process != p || w.replacement != nil {
+		return
+	}
+
+	w.log.Info("Recycling node process", "pid", p.PID(), "reason", reason, "requests", atomic.LoadInt64(&p.requests), "heap", atomic.LoadInt64(&p.heap))
+
+	replacement, err := vm.startProcess(w)
+	if err != nil {
+		w.log.Info("Error starting replacement node process", "error", err)
+
+		vm.retryAgeRecycle(p)
+
+		return
+	}
+
+	w.replacement = replacement
+}
+
+// retryAgeRecycle re-arms the age timer of a process whose replacement could
+// not be started or exited before it took over, so that it is recycled after
+// Options.MaxRestartBackoff. The caller must hold the worker's mutex.
+func (vm *nodeJsVM) retryAgeRecycle(p *process) {
+	if p == nil || p.ageTimer == nil || time.Since(p.startedAt) < vm.options.MaxWorkerAge {
+		return
+	}
+
+	p.ageTimer.Reset(vm.options.MaxRestartBackoff)
+}
+
+// retire waits for the in-flight requests of a process that was replaced to
+// finish and kills it.
+func (vm *nodeJsVM) retire(p *process) {
+	w := p.worker
+
+	w.mutex.Lock()
+	connection := p.connection
+	w.mutex.Unlock()
+
+	if connection != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), vm.options.DrainTimeout)
+		defer cancel()
+
+		if err := connection.Drain(ctx); err != nil {
+			w.log.Info("Node process did not drain in time", "pid", p.PID(), "pending", connection.GetPendingRequests())
+		}
+	}
+
+	w.log.Debug("Stopping retired node process", "pid", p.PID())
+
+	vm.stopProcesses(context.Background(), p)
+}
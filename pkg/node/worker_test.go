@@ -0,0 +1,193 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lukeshay/govite/pkg/utils/nodejs"
+)
+
+// waitFor polls condition until it is true or the timeout passes.
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition was not met in time")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWorkerRestartsAfterExit(t *testing.T) {
+	vm := newTestVM(t, Options{RestartBackoff: 10 * time.Millisecond})
+
+	w := vm.workers[0]
+	pid := w.PID()
+
+	if err := killProcesses(w.Process()); err != nil {
+		t.Fatalf("could not kill worker: %v", err)
+	}
+
+	waitFor(t, 5*time.Second, func() bool { return w.Restarts() == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := vm.Ready(ctx); err != nil {
+		t.Fatalf("restarted worker did not become ready: %v", err)
+	}
+
+	if w.PID() == pid {
+		t.Fatalf("expected a new process, got pid %d again", pid)
+	}
+
+	if _, err := vm.Render(ctx, testEntry(t), "/", nil); err != nil {
+		t.Fatalf("could not render on restarted worker: %v", err)
+	}
+}
+
+func TestWorkerExitFailsInFlightRequests(t *testing.T) {
+	vm := newTestVM(t, Options{RestartBackoff: 10 * time.Millisecond})
+
+	w := vm.workers[0]
+
+	errs := make(chan error, 1)
+
+	go func() {
+		_, err := vm.Render(context.Background(), testEntry(t), "/", map[string]any{"hang": true})
+		errs <- err
+	}()
+
+	waitFor(t, 5*time.Second, func() bool { return w.Connection().GetPendingRequests() == 1 })
+
+	if err := killProcesses(w.Process()); err != nil {
+		t.Fatalf("could not kill worker: %v", err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrWorkerExited) {
+			t.Fatalf("expected ErrWorkerExited, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("in-flight request did not fail")
+	}
+}
+
+// flakyRuntime is node, except that its processes fail to start while fail is
+// set.
+type flakyRuntime struct {
+	nodejs.NodeRuntime
+	fail atomic.Bool
+}
+
+func (r *flakyRuntime) Command(options nodejs.NodeJSCommandOptions) *exec.Cmd {
+	if r.fail.Load() {
+		return exec.Command(filepath.Join(os.TempDir(), "govite-does-not-exist"))
+	}
+
+	return r.NodeRuntime.Command(options)
+}
+
+func TestWorkerRecyclesByRequests(t *testing.T) {
+	vm := newTestVM(t, Options{MaxRequestsPerWorker: 2})
+
+	w := vm.workers[0]
+	pid := w.PID()
+
+	for i := 0; i < 2; i++ {
+		if _, err := vm.Render(context.Background(), testEntry(t), "/", nil); err != nil {
+			t.Fatalf("could not render: %v", err)
+		}
+	}
+
+	waitFor(t, 5*time.Second, func() bool { return w.Recycles() == 1 })
+
+	if w.PID() == pid {
+		t.Fatalf("expected a new process, got pid %d again", pid)
+	}
+	if w.Restarts() != 0 {
+		t.Fatalf("expected no restarts, got %d", w.Restarts())
+	}
+}
+
+func TestWorkerRecyclesByAgeAfterFailedReplacement(t *testing.T) {
+	runtime := &flakyRuntime{}
+
+	vm := newTestVM(t, Options{
+		Runtime:           runtime,
+		MaxWorkerAge:      100 * time.Millisecond,
+		MaxRestartBackoff: 50 * time.Millisecond,
+	})
+
+	w := vm.workers[0]
+
+	runtime.fail.Store(true)
+
+	// The first replacements fail to start.
+	time.Sleep(300 * time.Millisecond)
+
+	if w.Recycles() != 0 {
+		t.Fatalf("expected no recycles while failing, got %d", w.Recycles())
+	}
+
+	runtime.fail.Store(false)
+
+	waitFor(t, 5*time.Second, func() bool { return w.Recycles() >= 1 })
+}
+
+func TestWorkerReplacementTakesOverWhenRecycledProcessExits(t *testing.T) {
+	// The backoff outlasts the handshake of the replacement, which attaches
+	// while the worker has no process.
+	backoff := 300 * time.Millisecond
+
+	vm := newTestVM(t, Options{RestartBackoff: backoff, MaxRestartBackoff: backoff})
+
+	w := vm.workers[0]
+	p := w.Process()
+
+	vm.recycle(p, "test")
+
+	if err := killProcesses(p); err != nil {
+		t.Fatalf("could not kill worker: %v", err)
+	}
+
+	waitFor(t, 5*time.Second, func() bool { return w.Restarts() == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := vm.Ready(ctx); err != nil {
+		t.Fatalf("replacement did not become ready: %v", err)
+	}
+	if _, err := vm.Render(ctx, testEntry(t), "/", nil); err != nil {
+		t.Fatalf("could not render on the replacement: %v", err)
+	}
+
+	// The worker is not restarted after the backoff as well.
+	time.Sleep(backoff + 100*time.Millisecond)
+
+	running := 0
+	vm.running.Range(func(_, _ any) bool {
+		running++
+
+		return true
+	})
+
+	if running != 1 {
+		t.Fatalf("expected a single running process, got %d", running)
+	}
+	if w.Process() == p || w.Restarts() != 1 {
+		t.Fatalf("expected the replacement to serve the worker, got pid %d and %d restarts", w.PID(), w.Restarts())
+	}
+}
@@ -0,0 +1,150 @@
+// Package otel traces the renders of a production engine with OpenTelemetry,
+// including the spans recorded by the node processes for importing the server
+// entry, calling render and every fetch made while rendering.
+//
+//	eng := engine.MustNewProductionEngine(engine.ProductionEngineOptions{
+//		Tracer: otel.New(),
+//	})
+package otel
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/lukeshay/govite/pkg/node"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the spans.
+const ScopeName = "github.com/lukeshay/govite"
+
+// Options for Tracer
+type Options struct {
+	// TracerProvider provides the tracer of the spans. Default is the global
+	// provider.
+	TracerProvider trace.TracerProvider
+}
+
+// Tracer is a node.Tracer creating OpenTelemetry spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ node.Tracer = (*Tracer)(nil)
+
+// New returns a Tracer using the provider of the options.
+func New(options ...Options) *Tracer {
+	option := Options{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+
+	provider := option.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	return &Tracer{tracer: provider.Tracer(ScopeName)}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string, attributes map[string]any) (context.Context, func(err error)) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(toAttributes(attributes)...))
+
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		span.End()
+	}
+}
+
+func (t *Tracer) Traceparent(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() || !spanContext.IsSampled() {
+		return ""
+	}
+
+	return fmt.Sprintf("00-%s-%s-%s", spanContext.TraceID(), spanContext.SpanID(), spanContext.TraceFlags())
+}
+
+// Export recreates the spans of the worker as children of the span in ctx.
+// The OpenTelemetry API cannot create spans with the IDs chosen by the worker,
+// so every span gets a new ID and the parents are mapped accordingly.
+func (t *Tracer) Export(ctx context.Context, spans []node.Span) {
+	// Parents start before their children, so they are created first.
+	spans = slices.Clone(spans)
+	slices.SortStableFunc(spans, func(a, b node.Span) int {
+		switch {
+		case a.Start < b.Start:
+			return -1
+		case a.Start > b.Start:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	parents := map[string]context.Context{}
+
+	for _, recorded := range spans {
+		parent, ok := parents[recorded.ParentSpanID]
+		if !ok {
+			parent = ctx
+		}
+
+		spanCtx, span := t.tracer.Start(parent, recorded.Name,
+			trace.WithTimestamp(toTime(recorded.Start)),
+			trace.WithAttributes(toAttributes(recorded.Attributes)...),
+		)
+
+		if recorded.Error != "" {
+			span.SetStatus(codes.Error, recorded.Error)
+		}
+
+		span.End(trace.WithTimestamp(toTime(recorded.End)))
+
+		parents[recorded.SpanID] = spanCtx
+	}
+}
+
+func toTime(milliseconds float64) time.Time {
+	seconds, fraction := math.Modf(milliseconds / 1000)
+
+	return time.Unix(int64(seconds), int64(fraction*1e9))
+}
+
+func toAttributes(attributes map[string]any) []attribute.KeyValue {
+	result := make([]attribute.KeyValue, 0, len(attributes))
+
+	for key, value := range attributes {
+		switch v := value.(type) {
+		case string:
+			result = append(result, attribute.String(key, v))
+		case bool:
+			result = append(result, attribute.Bool(key, v))
+		case int:
+			result = append(result, attribute.Int(key, v))
+		case int64:
+			result = append(result, attribute.Int64(key, v))
+		case float64:
+			// Numbers decoded from JSON are float64.
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				result = append(result, attribute.Int64(key, int64(v)))
+			} else {
+				result = append(result, attribute.Float64(key, v))
+			}
+		default:
+			result = append(result, attribute.String(key, fmt.Sprint(v)))
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,231 @@
+package otel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lukeshay/govite/pkg/node"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// recorder is a trace.TracerProvider recording every span.
+type recorder struct {
+	embedded.TracerProvider
+
+	mutex sync.Mutex
+	ids   uint64
+	spans []*span
+}
+
+type span struct {
+	embedded.Span
+
+	recorder   *recorder
+	name       string
+	context    trace.SpanContext
+	parent     trace.SpanID
+	start      time.Time
+	end        time.Time
+	attributes []attribute.KeyValue
+	status     codes.Code
+	errors     []error
+}
+
+type recordingTracer struct {
+	embedded.Tracer
+
+	recorder *recorder
+}
+
+func (r *recorder) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return &recordingTracer{recorder: r}
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(options...)
+	parent := trace.SpanContextFromContext(ctx)
+	r := t.recorder
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.ids++
+
+	var spanID trace.SpanID
+	binary.BigEndian.PutUint64(spanID[:], r.ids)
+
+	traceID := parent.TraceID()
+	if !parent.IsValid() {
+		binary.BigEndian.PutUint64(traceID[8:], r.ids)
+	}
+
+	s := &span{
+		recorder: r,
+		name:     name,
+		context: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: trace.FlagsSampled,
+		}),
+		parent:     parent.SpanID(),
+		start:      config.Timestamp(),
+		attributes: config.Attributes(),
+	}
+
+	r.spans = append(r.spans, s)
+
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func (r *recorder) find(name string) *span {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, s := range r.spans {
+		if s.name == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
+func (s *span) End(options ...trace.SpanEndOption) {
+	config := trace.NewSpanEndConfig(options...)
+	s.end = config.Timestamp()
+}
+
+func (s *span) AddEvent(string, ...trace.EventOption)         {}
+func (s *span) IsRecording() bool                             { return true }
+func (s *span) RecordError(err error, _ ...trace.EventOption) { s.errors = append(s.errors, err) }
+func (s *span) SpanContext() trace.SpanContext                { return s.context }
+func (s *span) SetStatus(code codes.Code, _ string)           { s.status = code }
+func (s *span) SetName(name string)                           { s.name = name }
+func (s *span) SetAttributes(kv ...attribute.KeyValue)        { s.attributes = append(s.attributes, kv...) }
+func (s *span) TracerProvider() trace.TracerProvider          { return s.recorder }
+
+func (s *span) attribute(key string) attribute.Value {
+	for _, kv := range s.attributes {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+
+	return attribute.Value{}
+}
+
+func TestStart(t *testing.T) {
+	r := &recorder{}
+	tracer := New(Options{TracerProvider: r})
+
+	ctx, end := tracer.Start(context.Background(), "govite.vm.render", map[string]any{"url.path": "/"})
+
+	if traceparent := tracer.Traceparent(ctx); traceparent != "00-00000000000000000000000000000001-0000000000000001-01" {
+		t.Errorf("unexpected traceparent %q", traceparent)
+	}
+
+	end(errors.New("boom"))
+
+	s := r.find("govite.vm.render")
+
+	if s.status != codes.Error || len(s.errors) != 1 {
+		t.Errorf("expected the span to record the error, got %+v", s)
+	}
+	if s.attribute("url.path").AsString() != "/" {
+		t.Errorf("expected the url.path attribute, got %v", s.attributes)
+	}
+}
+
+func TestTraceparentWithoutSpan(t *testing.T) {
+	if traceparent := New(Options{TracerProvider: &recorder{}}).Traceparent(context.Background()); traceparent != "" {
+		t.Fatalf("expected no traceparent, got %q", traceparent)
+	}
+}
+
+func TestExport(t *testing.T) {
+	r := &recorder{}
+	tracer := New(Options{TracerProvider: r})
+
+	ctx, end := tracer.Start(context.Background(), "govite.vm.render", nil)
+	defer end(nil)
+
+	// The worker reports the render before the import it contains.
+	tracer.Export(ctx, []node.Span{
+		{SpanID: "b", ParentSpanID: "a", Name: "fetch", Start: 1500, End: 1600, Attributes: map[string]any{"http.response.status_code": 200.0}},
+		{SpanID: "a", ParentSpanID: "root", Name: "render", Start: 1000, End: 2000, Error: "boom"},
+	})
+
+	parent := r.find("govite.vm.render")
+	render := r.find("render")
+	fetch := r.find("fetch")
+
+	if render.parent != parent.context.SpanID() {
+		t.Errorf("expected render to be a child of the request span")
+	}
+	if fetch.parent != render.context.SpanID() {
+		t.Errorf("expected fetch to be a child of render")
+	}
+	if render.status != codes.Error {
+		t.Errorf("expected render to have an error status")
+	}
+	if !render.start.Equal(time.UnixMilli(1000)) || !render.end.Equal(time.UnixMilli(2000)) {
+		t.Errorf("unexpected times of render %s to %s", render.start, render.end)
+	}
+	if value := fetch.attribute("http.response.status_code"); value.Type() != attribute.INT64 || value.AsInt64() != 200 {
+		t.Errorf("expected an integer status code, got %v", value.Emit())
+	}
+}
+
+func TestTraceRender(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping node VM in short mode")
+	}
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skipf("node is not installed: %v", err)
+	}
+
+	r := &recorder{}
+
+	vm, err := node.NewNodeJS(node.Options{
+		NodeProcesses: 1,
+		WaitForReady:  true,
+		Tracer:        New(Options{TracerProvider: r}),
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	entry, err := filepath.Abs(filepath.Join("testdata", "entry.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := vm.Render(context.Background(), entry, "/", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	request := r.find("govite.vm.render")
+	if request == nil {
+		t.Fatal("expected a span for the request")
+	}
+
+	for _, name := range []string{"import", "render"} {
+		s := r.find(name)
+		if s == nil || s.parent != request.context.SpanID() {
+			t.Errorf("expected a %s span as a child of the request", name)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+export async function render(props, url) {
+	return `<p>${url}</p>`
+}
@@ -0,0 +1,38 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrNotFound is returned by a loader to respond with the NotFound handler of
+// the router instead of rendering.
+var ErrNotFound = errors.New("not found")
+
+// ErrInvalidPage is matched by the errors of pages whose file name does not
+// make a valid route.
+var ErrInvalidPage = errors.New("invalid page")
+
+// RedirectError is returned by a loader to redirect the request instead of
+// rendering. Create it with Redirect.
+type RedirectError struct {
+	// URL is the location the request is redirected to.
+	URL string
+	// Code is the 3xx status code of the redirect.
+	Code int
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("redirect %d to %s", e.Code, e.URL)
+}
+
+// Redirect returns an error that makes the router redirect the request to
+// url with code. Code defaults to http.StatusFound when it is 0.
+func Redirect(url string, code int) error {
+	if code == 0 {
+		code = http.StatusFound
+	}
+
+	return &RedirectError{URL: url, Code: code}
+}
@@ -0,0 +1,89 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ManifestChunk is an entry of the manifest written by `vite build` with
+// `build.manifest` enabled.
+type ManifestChunk struct {
+	File           string   `json:"file"`
+	Name           string   `json:"name,omitempty"`
+	Src            string   `json:"src,omitempty"`
+	IsEntry        bool     `json:"isEntry,omitempty"`
+	IsDynamicEntry bool     `json:"isDynamicEntry,omitempty"`
+	Imports        []string `json:"imports,omitempty"`
+	DynamicImports []string `json:"dynamicImports,omitempty"`
+	CSS            []string `json:"css,omitempty"`
+	Assets         []string `json:"assets,omitempty"`
+}
+
+// Manifest maps the source files of a Vite build, relative to the root of
+// the project, to their chunks.
+type Manifest map[string]ManifestChunk
+
+// ReadManifest reads the manifest of the client build in dir, i.e. the
+// StaticPath of a production engine. Both .vite/manifest.json of Vite 5 and
+// manifest.json of earlier versions are read.
+func ReadManifest(dir string) (Manifest, error) {
+	var manifest Manifest
+
+	for _, name := range []string{filepath.Join(".vite", "manifest.json"), "manifest.json"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, err
+		}
+
+		return manifest, nil
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: filepath.Join(dir, ".vite", "manifest.json"), Err: fs.ErrNotExist}
+}
+
+// Preloads returns the files of the chunk of the source file and of every
+// chunk it imports statically, and their stylesheets, in the order they are
+// imported.
+func (m Manifest) Preloads(src string) (scripts []string, styles []string) {
+	seen := map[string]bool{}
+
+	var visit func(key string)
+	visit = func(key string) {
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+
+		chunk, ok := m[key]
+		if !ok {
+			return
+		}
+
+		scripts = append(scripts, chunk.File)
+
+		for _, style := range chunk.CSS {
+			if !seen[style] {
+				seen[style] = true
+				styles = append(styles, style)
+			}
+		}
+
+		for _, imported := range chunk.Imports {
+			visit(imported)
+		}
+	}
+
+	visit(src)
+
+	return scripts, styles
+}
@@ -0,0 +1,285 @@
+package router
+
+import (
+	"fmt"
+	"go/token"
+	"html"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// PagesOptions for Manifest.Pages and ReadPages
+type PagesOptions struct {
+	// Dir is the directory of the pages relative to the root of the project.
+	// Default is "src/pages".
+	Dir string
+	// Base is the public base path the client build is served from, as in
+	// the Vite config. Default is "/".
+	Base string
+}
+
+func (o PagesOptions) withDefaults() PagesOptions {
+	if o.Dir == "" {
+		o.Dir = "src/pages"
+	}
+	if o.Base == "" {
+		o.Base = "/"
+	}
+
+	o.Dir = strings.Trim(filepath.ToSlash(o.Dir), "/")
+
+	if !strings.HasSuffix(o.Base, "/") {
+		o.Base += "/"
+	}
+
+	return o
+}
+
+// pageExtensions are the extensions of the files that are pages.
+var pageExtensions = map[string]bool{
+	".js":     true,
+	".jsx":    true,
+	".ts":     true,
+	".tsx":    true,
+	".vue":    true,
+	".svelte": true,
+	".md":     true,
+	".mdx":    true,
+}
+
+// Page is a route defined by a file in the pages directory. Dynamic segments
+// in brackets become path values of the pattern:
+//
+//	src/pages/index.tsx          GET /{$}
+//	src/pages/about.tsx          GET /about
+//	src/pages/users/index.tsx    GET /users
+//	src/pages/users/[id].tsx     GET /users/{id}
+//	src/pages/docs/[...path].tsx GET /docs/{path...}
+//
+// The names of the dynamic segments must be unique Go identifiers, and a
+// catch-all segment must be the last. Files and directories starting with "_"
+// or "." are not pages.
+type Page struct {
+	// Name is the path of the file relative to the pages directory without
+	// its extension, i.e. "users/[id]". The server entry renders the page by
+	// this name.
+	Name string
+	// Pattern is the http.ServeMux pattern of the page.
+	Pattern string
+	// Params are the names of the dynamic segments of the page.
+	Params []string
+	// Scripts are the URLs of the client chunk of the page and the chunks it
+	// imports, which are preloaded when the page is rendered.
+	Scripts []string
+	// Styles are the URLs of the stylesheets of the page.
+	Styles []string
+}
+
+// Pages returns the pages of the client build, sorted by name. The pages
+// directory must be part of the client build, i.e. by importing the pages
+// with import.meta.glob in the client entry. It returns an error matching
+// ErrInvalidPage if a page has an invalid name or the pattern of another page.
+func (m Manifest) Pages(options ...PagesOptions) ([]Page, error) {
+	option := PagesOptions{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+
+	option = option.withDefaults()
+
+	var pages []Page
+
+	for src := range m {
+		rel, ok := strings.CutPrefix(src, option.Dir+"/")
+		if !ok {
+			continue
+		}
+
+		page, ok, err := newPage(rel)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		scripts, styles := m.Preloads(src)
+
+		for _, script := range scripts {
+			page.Scripts = append(page.Scripts, option.Base+script)
+		}
+		for _, style := range styles {
+			page.Styles = append(page.Styles, option.Base+style)
+		}
+
+		pages = append(pages, page)
+	}
+
+	return sortPages(pages)
+}
+
+// ReadPages returns the pages in the pages directory of the project in
+// appDir, sorted by name. Pages read from the sources are not preloaded, so
+// ReadPages is meant for development, where Vite serves the sources. It
+// returns an error matching ErrInvalidPage like Manifest.Pages.
+func ReadPages(appDir string, options ...PagesOptions) ([]Page, error) {
+	option := PagesOptions{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+
+	option = option.withDefaults()
+
+	dir := filepath.Join(appDir, filepath.FromSlash(option.Dir))
+
+	var pages []Page
+
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if file != dir && isHidden(entry.Name()) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+
+		page, ok, err := newPage(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		if ok {
+			pages = append(pages, page)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sortPages(pages)
+}
+
+// newPage returns the page of the file at rel in the pages directory, or false
+// if the file is not a page. Pages with dynamic segments http.ServeMux does not
+// accept return an error.
+func newPage(rel string) (Page, bool, error) {
+	ext := path.Ext(rel)
+
+	if !pageExtensions[ext] || strings.HasSuffix(rel, ".d.ts") {
+		return Page{}, false, nil
+	}
+
+	name := strings.TrimSuffix(rel, ext)
+
+	page := Page{Name: name}
+
+	var segments []string
+
+	parts := strings.Split(name, "/")
+
+	for i, part := range parts {
+		if isHidden(part) {
+			return Page{}, false, nil
+		}
+
+		switch {
+		case part == "index" && i == len(parts)-1:
+		case strings.HasPrefix(part, "[...") && strings.HasSuffix(part, "]"):
+			param := strings.TrimSuffix(strings.TrimPrefix(part, "[..."), "]")
+
+			if i != len(parts)-1 {
+				return Page{}, false, fmt.Errorf("%w %s: catch-all segment %s is not the last", ErrInvalidPage, rel, part)
+			}
+			if err := page.addParam(param); err != nil {
+				return Page{}, false, fmt.Errorf("%w %s: %w", ErrInvalidPage, rel, err)
+			}
+
+			segments = append(segments, fmt.Sprintf("{%s...}", param))
+		case strings.HasPrefix(part, "[") && strings.HasSuffix(part, "]"):
+			param := strings.TrimSuffix(strings.TrimPrefix(part, "["), "]")
+
+			if err := page.addParam(param); err != nil {
+				return Page{}, false, fmt.Errorf("%w %s: %w", ErrInvalidPage, rel, err)
+			}
+
+			segments = append(segments, fmt.Sprintf("{%s}", param))
+		default:
+			segments = append(segments, part)
+		}
+	}
+
+	if len(segments) == 0 {
+		page.Pattern = "GET /{$}"
+	} else {
+		page.Pattern = "GET /" + strings.Join(segments, "/")
+	}
+
+	return page, true, nil
+}
+
+// addParam adds the name of a dynamic segment to the params of the page.
+func (p *Page) addParam(param string) error {
+	if !token.IsIdentifier(param) {
+		return fmt.Errorf("segment name %q is not a Go identifier", param)
+	}
+	if slices.Contains(p.Params, param) {
+		return fmt.Errorf("segment name %q is used twice", param)
+	}
+
+	p.Params = append(p.Params, param)
+
+	return nil
+}
+
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".")
+}
+
+// sortPages sorts the pages by name and checks that no two pages have the
+// same pattern, i.e. "users.tsx" and "users/index.tsx".
+func sortPages(pages []Page) ([]Page, error) {
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Name < pages[j].Name
+	})
+
+	names := make(map[string]string, len(pages))
+
+	for _, page := range pages {
+		if name, ok := names[page.Pattern]; ok {
+			return nil, fmt.Errorf("%w %s: pattern %q of page %s", ErrInvalidPage, page.Name, page.Pattern, name)
+		}
+
+		names[page.Pattern] = page.Name
+	}
+
+	return pages, nil
+}
+
+// preloadTags returns the link tags preloading the scripts and stylesheets of
+// the page.
+func (p *Page) preloadTags() string {
+	var tags strings.Builder
+
+	for _, style := range p.Styles {
+		fmt.Fprintf(&tags, "<link rel=\"stylesheet\" href=\"%s\">", html.EscapeString(style))
+	}
+	for _, script := range p.Scripts {
+		fmt.Fprintf(&tags, "<link rel=\"modulepreload\" crossorigin href=\"%s\">", html.EscapeString(script))
+	}
+
+	return tags.String()
+}
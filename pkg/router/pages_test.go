@@ -0,0 +1,157 @@
+package router
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewPage(t *testing.T) {
+	tests := []struct {
+		rel     string
+		want    Page
+		notPage bool
+		wantErr string
+	}{
+		{rel: "index.tsx", want: Page{Name: "index", Pattern: "GET /{$}"}},
+		{rel: "about.vue", want: Page{Name: "about", Pattern: "GET /about"}},
+		{rel: "users/index.tsx", want: Page{Name: "users/index", Pattern: "GET /users"}},
+		{rel: "users/[id].tsx", want: Page{Name: "users/[id]", Pattern: "GET /users/{id}", Params: []string{"id"}}},
+		{rel: "users/[id]/posts/[post].tsx", want: Page{Name: "users/[id]/posts/[post]", Pattern: "GET /users/{id}/posts/{post}", Params: []string{"id", "post"}}},
+		{rel: "docs/[...path].mdx", want: Page{Name: "docs/[...path]", Pattern: "GET /docs/{path...}", Params: []string{"path"}}},
+		{rel: "index/about.tsx", want: Page{Name: "index/about", Pattern: "GET /index/about"}},
+		{rel: "_layout.tsx", notPage: true},
+		{rel: "users/_components/card.tsx", notPage: true},
+		{rel: "types.d.ts", notPage: true},
+		{rel: "styles.css", notPage: true},
+		{rel: "docs/[...path]/edit.tsx", wantErr: "catch-all segment [...path] is not the last"},
+		{rel: "[id]/[id].tsx", wantErr: `segment name "id" is used twice`},
+		{rel: "[id]/[...id].tsx", wantErr: `segment name "id" is used twice`},
+		{rel: "users/[user-id].tsx", wantErr: `segment name "user-id" is not a Go identifier`},
+		{rel: "users/[].tsx", wantErr: `segment name "" is not a Go identifier`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			page, ok, err := newPage(tt.rel)
+
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidPage) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an invalid page error containing %q, got %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok == tt.notPage {
+				t.Fatalf("expected page %v, got %v", !tt.notPage, ok)
+			}
+			if !ok {
+				return
+			}
+
+			if !reflect.DeepEqual(page, tt.want) {
+				t.Errorf("got %+v, want %+v", page, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestPages(t *testing.T) {
+	manifest, err := ReadManifest("testdata")
+	if err != nil {
+		t.Fatalf("could not read manifest: %v", err)
+	}
+
+	pages, err := manifest.Pages(PagesOptions{Base: "/static"})
+	if err != nil {
+		t.Fatalf("could not read pages: %v", err)
+	}
+
+	want := []Page{
+		{
+			Name:    "index",
+			Pattern: "GET /{$}",
+			Scripts: []string{"/static/assets/index-A1b2C3d4.js", "/static/assets/vendor-C2dm7QXa.js"},
+		},
+		{
+			Name:    "users/[id]",
+			Pattern: "GET /users/{id}",
+			Params:  []string{"id"},
+			Scripts: []string{"/static/assets/_id_-E5f6G7h8.js", "/static/assets/vendor-C2dm7QXa.js"},
+			Styles:  []string{"/static/assets/_id_-Zz9y8X7w.css"},
+		},
+	}
+
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("got %+v, want %+v", pages, want)
+	}
+}
+
+func TestManifestPagesRejectsInvalidPages(t *testing.T) {
+	manifest := Manifest{
+		"src/pages/users.tsx":       {File: "assets/users-A1b2C3d4.js"},
+		"src/pages/users/index.tsx": {File: "assets/index-E5f6G7h8.js"},
+	}
+
+	if _, err := manifest.Pages(); !errors.Is(err, ErrInvalidPage) {
+		t.Errorf("expected pages with the same pattern to be rejected, got %v", err)
+	}
+}
+
+func TestReadPages(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, file := range []string{"index.tsx", "users/[id].tsx", "_components/card.tsx", ".cache/page.tsx", "about.css"} {
+		writePage(t, dir, file)
+	}
+
+	pages, err := ReadPages(dir)
+	if err != nil {
+		t.Fatalf("could not read pages: %v", err)
+	}
+
+	var names []string
+	for _, page := range pages {
+		names = append(names, page.Name)
+	}
+
+	if want := []string{"index", "users/[id]"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+
+	writePage(t, dir, "docs/[...path]/edit.tsx")
+
+	if _, err := ReadPages(dir); !errors.Is(err, ErrInvalidPage) {
+		t.Errorf("expected an invalid page error, got %v", err)
+	}
+}
+
+func TestPreloadTags(t *testing.T) {
+	page := Page{Scripts: []string{"/assets/a.js"}, Styles: []string{"/assets/a.css?v=1&x"}}
+
+	want := `<link rel="stylesheet" href="/assets/a.css?v=1&amp;x"><link rel="modulepreload" crossorigin href="/assets/a.js">`
+
+	if got := page.preloadTags(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func writePage(t *testing.T, dir string, file string) {
+	t.Helper()
+
+	path := filepath.Join(dir, "src", "pages", filepath.FromSlash(file))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,276 @@
+// Package router renders the routes of an application with an engine after
+// loading their props with a Go loader.
+//
+//	r := router.New(eng)
+//	r.Handle("GET /users/{id}", func(ctx context.Context, req *http.Request) (any, error) {
+//		user, err := users.Get(ctx, req.PathValue("id"))
+//		if errors.Is(err, users.ErrNotFound) {
+//			return nil, router.ErrNotFound
+//		}
+//
+//		return user, err
+//	})
+//	http.ListenAndServe(":3000", r)
+//
+// Requests asking for JSON with `Accept: application/json` get the props of
+// the route instead of the rendered HTML, so client-side navigation can load
+// the data of the next page without a full server render.
+//
+// The files in src/pages can define the routes instead, discovered from the
+// manifest of the client build in production or from the sources in
+// development. The server entry renders the page by its name:
+//
+//	manifest, err := router.ReadManifest(eng.StaticPath())
+//	if err != nil {
+//		return err
+//	}
+//	pages, err := manifest.Pages()
+//	if err != nil {
+//		return err
+//	}
+//	r.HandlePages(pages, map[string]router.Loader{
+//		"users/[id]": loadUser,
+//	})
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/lukeshay/govite/internal/logging"
+	"github.com/lukeshay/govite/pkg/engine"
+	"github.com/lukeshay/govite/pkg/node"
+)
+
+// Loader loads the props a route is rendered with. Path values of the pattern
+// of the route are available with r.PathValue. Returning ErrNotFound or an
+// error created with Redirect responds with a 404 or a redirect instead of
+// rendering.
+type Loader func(ctx context.Context, r *http.Request) (props any, err error)
+
+// Options for Router
+type Options struct {
+	// Logger is the logger used for the errors of loaders and renders.
+	Logger *slog.Logger
+	// NotFound serves the requests that match no route and the routes whose
+	// loader returned ErrNotFound. Default is a 404 with a plain text body, or
+	// a JSON body when the request asks for JSON.
+	NotFound http.Handler
+	// ErrorHandler responds to the requests whose loader or render failed.
+	// Default is a 500 with a plain text body, or a JSON body when the request
+	// asks for JSON. Renders that were shed because the engine is overloaded
+	// or shutting down get a 503.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Router is an http.Handler rendering the route matching the request with
+// the props returned by its loader. Patterns are those of http.ServeMux.
+type Router struct {
+	engine       engine.Engine
+	mux          *http.ServeMux
+	log          *slog.Logger
+	notFound     http.Handler
+	errorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+var _ http.Handler = (*Router)(nil)
+
+// New returns a Router rendering its routes with the engine.
+func New(e engine.Engine, options ...Options) *Router {
+	option := Options{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+
+	r := &Router{
+		engine:       e,
+		mux:          http.NewServeMux(),
+		log:          logging.NewDefaultLogger(option.Logger),
+		notFound:     option.NotFound,
+		errorHandler: option.ErrorHandler,
+	}
+
+	if r.notFound == nil {
+		r.notFound = http.HandlerFunc(notFound)
+	}
+	if r.errorHandler == nil {
+		r.errorHandler = r.handleError
+	}
+
+	return r
+}
+
+// Handle registers the route with the pattern. A nil loader renders the route
+// without props. Handle panics if the pattern conflicts with the pattern of
+// another route, like http.ServeMux.Handle.
+func (r *Router) Handle(pattern string, loader Loader) {
+	r.mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.serveRoute(w, req, loader, nil)
+	}))
+}
+
+// HandlePage registers the route of the page. The page is rendered with the
+// props of the loader and is given to the render function of the server
+// entry with the path values of its dynamic segments. Its scripts and
+// stylesheets are preloaded.
+func (r *Router) HandlePage(page Page, loader Loader) {
+	r.mux.Handle(page.Pattern, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.serveRoute(w, req, loader, &page)
+	}))
+}
+
+// HandlePages registers the routes of the pages, i.e. those returned by
+// Manifest.Pages or ReadPages, with the loaders by the name of their page.
+// Pages without a loader are rendered without props.
+func (r *Router) HandlePages(pages []Page, loaders map[string]Loader) {
+	for _, page := range pages {
+		r.HandlePage(page, loaders[page.Name])
+	}
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if _, pattern := r.mux.Handler(req); pattern == "" {
+		r.notFound.ServeHTTP(w, req)
+
+		return
+	}
+
+	r.mux.ServeHTTP(w, req)
+}
+
+func (r *Router) serveRoute(w http.ResponseWriter, req *http.Request, loader Loader, page *Page) {
+	ctx := engine.WithRequest(req.Context(), req)
+
+	if page != nil {
+		params := make(map[string]string, len(page.Params))
+		for _, param := range page.Params {
+			params[param] = req.PathValue(param)
+		}
+
+		ctx = engine.WithPage(ctx, node.Page{Name: page.Name, Params: params})
+	}
+
+	// The HTML and the JSON of a route are different representations of the
+	// same URL.
+	w.Header().Add("Vary", "Accept")
+
+	var props any
+
+	if loader != nil {
+		var err error
+
+		props, err = loader(ctx, req)
+		if err != nil {
+			r.handleLoaderError(w, req, err)
+
+			return
+		}
+	}
+
+	if WantsJSON(req) {
+		writeJSON(w, http.StatusOK, props)
+
+		return
+	}
+
+	result, err := r.engine.RenderContext(ctx, req.URL.Path, props)
+	if err != nil {
+		r.log.Debug("Error rendering route", "path", req.URL.Path, "error", err)
+
+		r.errorHandler(w, req, err)
+
+		return
+	}
+
+	for key, values := range result.Headers {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	content := result.Content
+	if page != nil {
+		content = strings.Replace(content, "</head>", page.preloadTags()+"</head>", 1)
+	}
+
+	w.Header().Set("Content-Type", result.ContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(content))
+}
+
+func (r *Router) handleLoaderError(w http.ResponseWriter, req *http.Request, err error) {
+	var redirect *RedirectError
+
+	switch {
+	case errors.As(err, &redirect):
+		http.Redirect(w, req, redirect.URL, redirect.Code)
+	case errors.Is(err, ErrNotFound):
+		r.notFound.ServeHTTP(w, req)
+	default:
+		r.log.Debug("Error loading route", "path", req.URL.Path, "error", err)
+
+		r.errorHandler(w, req, err)
+	}
+}
+
+func (r *Router) handleError(w http.ResponseWriter, req *http.Request, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, node.ErrOverloaded) || errors.Is(err, node.ErrShuttingDown) {
+		status = http.StatusServiceUnavailable
+	} else {
+		r.log.Error("Error serving route", "path", req.URL.Path, "error", err)
+	}
+
+	writeError(w, req, status)
+}
+
+func notFound(w http.ResponseWriter, req *http.Request) {
+	writeError(w, req, http.StatusNotFound)
+}
+
+// writeError writes the status text of the status, as JSON when the request
+// asks for JSON.
+func writeError(w http.ResponseWriter, req *http.Request, status int) {
+	if WantsJSON(req) {
+		writeJSON(w, status, map[string]string{"error": http.StatusText(status)})
+
+		return
+	}
+
+	http.Error(w, http.StatusText(status), status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(value)
+}
+
+// WantsJSON reports whether the request asks for JSON rather than HTML, i.e.
+// its Accept header lists application/json before text/html.
+func WantsJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(mediaRange)
+			if err != nil {
+				continue
+			}
+
+			switch mediaType {
+			case "application/json":
+				return true
+			case "text/html":
+				return false
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,203 @@
+package router_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lukeshay/govite/pkg/govitetest"
+	"github.com/lukeshay/govite/pkg/node"
+	"github.com/lukeshay/govite/pkg/router"
+)
+
+func newTestRouter(eng *govitetest.Engine) *router.Router {
+	r := router.New(eng, router.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+
+	r.Handle("GET /users/{id}", func(ctx context.Context, req *http.Request) (any, error) {
+		switch id := req.PathValue("id"); id {
+		case "0":
+			return nil, router.ErrNotFound
+		case "me":
+			return nil, router.Redirect("/users/7", 0)
+		case "fail":
+			return nil, errors.New("database is down")
+		default:
+			return map[string]any{"id": id}, nil
+		}
+	})
+	r.Handle("GET /about", nil)
+
+	return r
+}
+
+func TestRouter(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		accept      string
+		wantStatus  int
+		wantType    string
+		wantBody    string
+		wantRenders int
+	}{
+		{name: "renders HTML", path: "/users/7", wantStatus: http.StatusOK, wantType: "text/html", wantBody: `window.__INITIAL_STATE__ = {"id":"7"}`, wantRenders: 1},
+		{name: "renders without loader", path: "/about", wantStatus: http.StatusOK, wantType: "text/html", wantBody: `window.__INITIAL_STATE__ = null`, wantRenders: 1},
+		{name: "answers JSON", path: "/users/7", accept: "application/json, text/html", wantStatus: http.StatusOK, wantType: "application/json", wantBody: `{"id":"7"}`},
+		{name: "prefers HTML", path: "/users/7", accept: "text/html, application/json", wantStatus: http.StatusOK, wantType: "text/html", wantRenders: 1},
+		{name: "redirects", path: "/users/me", wantStatus: http.StatusFound},
+		{name: "loader not found", path: "/users/0", wantStatus: http.StatusNotFound, wantBody: "Not Found"},
+		{name: "no route", path: "/missing", wantStatus: http.StatusNotFound, wantBody: "Not Found"},
+		{name: "no route as JSON", path: "/missing", accept: "application/json", wantStatus: http.StatusNotFound, wantType: "application/json", wantBody: `{"error":"Not Found"}`},
+		{name: "loader error", path: "/users/fail", wantStatus: http.StatusInternalServerError, wantBody: "Internal Server Error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := govitetest.NewEngine()
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			w := httptest.NewRecorder()
+
+			newTestRouter(eng).ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantType != "" && !strings.HasPrefix(w.Header().Get("Content-Type"), tt.wantType) {
+				t.Errorf("expected content type %s, got %s", tt.wantType, w.Header().Get("Content-Type"))
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("expected the body to contain %s, got %s", tt.wantBody, w.Body.String())
+			}
+			if renders := len(eng.Renders()); renders != tt.wantRenders {
+				t.Errorf("expected %d renders, got %d", tt.wantRenders, renders)
+			}
+		})
+	}
+}
+
+func TestRouterRenderRequest(t *testing.T) {
+	eng := govitetest.NewEngine()
+
+	req := httptest.NewRequest(http.MethodGet, "/users/7?tab=posts", nil)
+	w := httptest.NewRecorder()
+
+	newTestRouter(eng).ServeHTTP(w, req)
+
+	render, ok := eng.LastRender()
+	if !ok {
+		t.Fatal("expected a render")
+	}
+	if render.URL != "/users/7" {
+		t.Errorf("expected the path to be rendered, got %s", render.URL)
+	}
+	if render.Request == nil || render.Request.URL.RawQuery != "tab=posts" {
+		t.Errorf("expected the request to be passed to the engine, got %v", render.Request)
+	}
+	if vary := w.Header().Get("Vary"); vary != "Accept" {
+		t.Errorf("expected Vary: Accept, got %q", vary)
+	}
+}
+
+func TestRouterRenderErrors(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+	}{
+		{err: node.ErrOverloaded, wantStatus: http.StatusServiceUnavailable},
+		{err: node.ErrShuttingDown, wantStatus: http.StatusServiceUnavailable},
+		{err: errors.New("render failed"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			eng := govitetest.NewEngine()
+			eng.SetResult("/users/7", nil, tt.err)
+
+			w := httptest.NewRecorder()
+
+			newTestRouter(eng).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/7", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRouterErrorHandler(t *testing.T) {
+	eng := govitetest.NewEngine()
+	eng.SetResult("/", nil, node.ErrOverloaded)
+
+	var handled error
+
+	r := router.New(eng, router.Options{ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+		handled = err
+		w.WriteHeader(http.StatusTeapot)
+	}})
+	r.Handle("GET /{$}", nil)
+
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusTeapot || !errors.Is(handled, node.ErrOverloaded) {
+		t.Errorf("expected the error handler to respond, got %d and %v", w.Code, handled)
+	}
+}
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		accept []string
+		want   bool
+	}{
+		{accept: nil, want: false},
+		{accept: []string{"application/json"}, want: true},
+		{accept: []string{"text/html,application/xhtml+xml,*/*;q=0.8"}, want: false},
+		{accept: []string{"application/json;q=0.9, text/html"}, want: true},
+		{accept: []string{"*/*", "application/json"}, want: true},
+		{accept: []string{"invalid;;", "text/html"}, want: false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, accept := range tt.accept {
+			req.Header.Add("Accept", accept)
+		}
+
+		if got := router.WantsJSON(req); got != tt.want {
+			t.Errorf("WantsJSON(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	var redirect *router.RedirectError
+
+	if err := router.Redirect("/login", 0); !errors.As(err, &redirect) || redirect.Code != http.StatusFound {
+		t.Errorf("expected a 302 redirect, got %v", err)
+	}
+
+	eng := govitetest.NewEngine()
+	r := router.New(eng)
+	r.Handle("GET /old", func(ctx context.Context, req *http.Request) (any, error) {
+		return nil, router.Redirect("/new", http.StatusMovedPermanently)
+	})
+
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/old", nil))
+
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/new" {
+		t.Errorf("expected a redirect to /new, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
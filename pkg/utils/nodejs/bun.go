@@ -0,0 +1,39 @@
+package nodejs
+
+import (
+	_ "embed"
+	"os/exec"
+)
+
+//go:embed shim_bun.js
+var bunShim string
+
+// BunRuntime runs scripts with Bun.
+type BunRuntime struct {
+	// Executable is the path to the "bun" executable. Default is "bun".
+	Executable string
+}
+
+func (r *BunRuntime) Name() string {
+	return "bun"
+}
+
+func (r *BunRuntime) Command(options NodeJSCommandOptions) *exec.Cmd {
+	flags := []string{}
+
+	if isFile(options.Script) {
+		flags = append(flags, "run")
+		flags = append(flags, options.Flags...)
+	} else {
+		flags = append(flags, options.Flags...)
+		flags = append(flags, "-e")
+	}
+
+	flags = append(flags, options.Script)
+
+	return newCommand(defaultExecutable(r.Executable, "bun"), flags, options)
+}
+
+func (r *BunRuntime) Shim() string {
+	return bunShim
+}
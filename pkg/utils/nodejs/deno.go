@@ -0,0 +1,44 @@
+package nodejs
+
+import (
+	_ "embed"
+	"os/exec"
+	"strings"
+)
+
+//go:embed shim_deno.js
+var denoShim string
+
+// DenoRuntime runs scripts with Deno. Scripts are run with all permissions
+// granted, matching the behaviour of Node.js and Bun.
+type DenoRuntime struct {
+	// Executable is the path to the "deno" executable. Default is "deno".
+	Executable string
+}
+
+func (r *DenoRuntime) Name() string {
+	return "deno"
+}
+
+func (r *DenoRuntime) Command(options NodeJSCommandOptions) *exec.Cmd {
+	flags := []string{}
+
+	if isFile(options.Script) {
+		flags = append(flags, "run", "--allow-all")
+	} else {
+		flags = append(flags, "eval")
+	}
+
+	if len(options.V8Flags) > 0 {
+		flags = append(flags, "--v8-flags="+strings.Join(options.V8Flags, ","))
+	}
+
+	flags = append(flags, options.Flags...)
+	flags = append(flags, options.Script)
+
+	return newCommand(defaultExecutable(r.Executable, "deno"), flags, options)
+}
+
+func (r *DenoRuntime) Shim() string {
+	return denoShim
+}
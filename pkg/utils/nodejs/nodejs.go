@@ -1,33 +1,99 @@
 package nodejs
 
 import (
+	_ "embed"
 	"io"
 	"os"
 	"os/exec"
 )
 
+//go:embed shim_node.js
+var nodeShim string
+
+// Runtime is a Javascript runtime that is able to run the govite VM and dev
+// server. Every runtime provides its own launch flags and a shim that exposes
+// the primitives the VM protocol is built upon.
+type Runtime interface {
+	// Name returns the name of the runtime, i.e. "node".
+	Name() string
+	// Command returns the command that runs the script in the given options.
+	Command(options NodeJSCommandOptions) *exec.Cmd
+	// Shim returns the Javascript that is prepended to the VM runtime. It must
+	// declare a `runtime` object implementing the `Runtime` interface from
+	// runtime.d.ts.
+	Shim() string
+}
+
+var (
+	// Node is the Node.js runtime using the "node" executable on the PATH.
+	Node Runtime = &NodeRuntime{}
+	// Bun is the Bun runtime using the "bun" executable on the PATH.
+	Bun Runtime = &BunRuntime{}
+	// Deno is the Deno runtime using the "deno" executable on the PATH.
+	Deno Runtime = &DenoRuntime{}
+)
+
+// DefaultRuntime returns the given runtime or Node if it is nil.
+func DefaultRuntime(runtime Runtime) Runtime {
+	if runtime == nil {
+		return Node
+	}
+
+	return runtime
+}
+
 type NodeJSCommandOptions struct {
-	Script string
-	Dir    string
-	Env    map[string]string
-	Flags  []string
-	Stdout io.Writer
-	Stderr io.Writer
-	Stdin  io.Reader
+	// Runtime is the runtime used to run the script. Default is Node.
+	Runtime Runtime
+	Script  string
+	Dir     string
+	Env     map[string]string
+	Flags   []string
+	// V8Flags are the flags passed to V8, i.e. "--max-old-space-size=512".
+	// Bun runs on JavaScriptCore and ignores them.
+	V8Flags []string
+	Stdout  io.Writer
+	Stderr  io.Writer
+	Stdin   io.Reader
 }
 
+// NewNodeJSCommand returns the command that runs the script with the runtime
+// in the given options.
 func NewNodeJSCommand(options NodeJSCommandOptions) *exec.Cmd {
-	flags := options.Flags
+	return DefaultRuntime(options.Runtime).Command(options)
+}
+
+// NodeRuntime runs scripts with Node.js.
+type NodeRuntime struct {
+	// Executable is the path to the "node" executable. Default is "node".
+	Executable string
+}
+
+func (r *NodeRuntime) Name() string {
+	return "node"
+}
+
+func (r *NodeRuntime) Command(options NodeJSCommandOptions) *exec.Cmd {
+	flags := append([]string{}, options.V8Flags...)
 
+	flags = append(flags, options.Flags...)
 	flags = append(flags, "--experimental-detect-module", "--no-warnings", "--input-type=module")
 
-	if _, err := os.Stat(options.Script); err != nil {
+	if !isFile(options.Script) {
 		flags = append(flags, "-e")
 	}
 
 	flags = append(flags, options.Script)
 
-	cmd := exec.Command("node", flags...)
+	return newCommand(defaultExecutable(r.Executable, "node"), flags, options)
+}
+
+func (r *NodeRuntime) Shim() string {
+	return nodeShim
+}
+
+func newCommand(executable string, args []string, options NodeJSCommandOptions) *exec.Cmd {
+	cmd := exec.Command(executable, args...)
 
 	for k, v := range options.Env {
 		cmd.Env = append(cmd.Env, k+"="+v)
@@ -40,3 +106,17 @@ func NewNodeJSCommand(options NodeJSCommandOptions) *exec.Cmd {
 
 	return cmd
 }
+
+func defaultExecutable(executable, defaultExecutable string) string {
+	if executable == "" {
+		return defaultExecutable
+	}
+
+	return executable
+}
+
+func isFile(script string) bool {
+	_, err := os.Stat(script)
+
+	return err == nil
+}
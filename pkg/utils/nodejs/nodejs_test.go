@@ -0,0 +1,138 @@
+package nodejs
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script.js")
+	if err := os.WriteFile(script, []byte("console.log(1)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		runtime Runtime
+		script  string
+		want    []string
+	}{
+		{
+			name:    "node file",
+			runtime: Node,
+			script:  script,
+			want:    []string{"node", "--max-old-space-size=64", "--enable-source-maps", "--experimental-detect-module", "--no-warnings", "--input-type=module", script},
+		},
+		{
+			name:    "node eval",
+			runtime: Node,
+			script:  "console.log(1)",
+			want:    []string{"node", "--max-old-space-size=64", "--enable-source-maps", "--experimental-detect-module", "--no-warnings", "--input-type=module", "-e", "console.log(1)"},
+		},
+		{
+			name:    "bun file",
+			runtime: Bun,
+			script:  script,
+			want:    []string{"bun", "run", "--enable-source-maps", script},
+		},
+		{
+			name:    "bun eval",
+			runtime: Bun,
+			script:  "console.log(1)",
+			want:    []string{"bun", "--enable-source-maps", "-e", "console.log(1)"},
+		},
+		{
+			name:    "deno file",
+			runtime: Deno,
+			script:  script,
+			want:    []string{"deno", "run", "--allow-all", "--v8-flags=--max-old-space-size=64", "--enable-source-maps", script},
+		},
+		{
+			name:    "deno eval",
+			runtime: Deno,
+			script:  "console.log(1)",
+			want:    []string{"deno", "eval", "--v8-flags=--max-old-space-size=64", "--enable-source-maps", "console.log(1)"},
+		},
+		{
+			name:    "executable",
+			runtime: &NodeRuntime{Executable: "/opt/node/bin/node"},
+			script:  "console.log(1)",
+			want:    []string{"/opt/node/bin/node", "--max-old-space-size=64", "--enable-source-maps", "--experimental-detect-module", "--no-warnings", "--input-type=module", "-e", "console.log(1)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := tt.runtime.Command(NodeJSCommandOptions{
+				Script:  tt.script,
+				Dir:     "app",
+				Env:     map[string]string{"NODE_ENV": "production"},
+				Flags:   []string{"--enable-source-maps"},
+				V8Flags: []string{"--max-old-space-size=64"},
+			})
+
+			if !reflect.DeepEqual(cmd.Args, tt.want) {
+				t.Errorf("got %v, want %v", cmd.Args, tt.want)
+			}
+			if cmd.Dir != "app" {
+				t.Errorf("unexpected dir %q", cmd.Dir)
+			}
+			if !slices.Equal(cmd.Env, []string{"NODE_ENV=production"}) {
+				t.Errorf("unexpected env %v", cmd.Env)
+			}
+		})
+	}
+}
+
+func TestNewNodeJSCommandDefaultsToNode(t *testing.T) {
+	cmd := NewNodeJSCommand(NodeJSCommandOptions{Script: "console.log(1)"})
+
+	if filepath.Base(cmd.Args[0]) != "node" {
+		t.Errorf("expected node, got %v", cmd.Args)
+	}
+	if DefaultRuntime(Bun) != Bun {
+		t.Errorf("expected the given runtime to be kept")
+	}
+}
+
+func TestShims(t *testing.T) {
+	for _, runtime := range []Runtime{Node, Bun, Deno} {
+		t.Run(runtime.Name(), func(t *testing.T) {
+			if !strings.Contains(runtime.Shim(), "const runtime") {
+				t.Errorf("expected the shim to declare runtime")
+			}
+		})
+	}
+}
+
+// TestRun runs a script with every installed runtime.
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping runtimes in short mode")
+	}
+
+	for _, runtime := range []Runtime{Node, Bun, Deno} {
+		t.Run(runtime.Name(), func(t *testing.T) {
+			if _, err := exec.LookPath(runtime.Name()); err != nil {
+				t.Skipf("%s is not installed: %v", runtime.Name(), err)
+			}
+
+			var stdout bytes.Buffer
+
+			cmd := runtime.Command(NodeJSCommandOptions{Script: "console.log(6 * 7)", Stdout: &stdout})
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("could not run %v: %v", cmd.Args, err)
+			}
+
+			if strings.TrimSpace(stdout.String()) != "42" {
+				t.Errorf("unexpected output %q", stdout.String())
+			}
+		})
+	}
+}
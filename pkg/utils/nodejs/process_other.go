@@ -0,0 +1,21 @@
+//go:build !unix
+
+package nodejs
+
+import (
+	"os/exec"
+)
+
+// SetProcessGroup is a no-op on platforms without process groups.
+func SetProcessGroup(cmd *exec.Cmd) {}
+
+// Terminate kills the started command, as there is no SIGTERM on this
+// platform.
+func Terminate(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// Kill kills the started command.
+func Kill(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package nodejs
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// SetProcessGroup makes the command start a new process group, so that it can
+// be stopped together with every process it starts.
+func SetProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// Terminate sends SIGTERM to the process group of the started command.
+func Terminate(cmd *exec.Cmd) error {
+	return signalGroup(cmd, syscall.SIGTERM)
+}
+
+// Kill sends SIGKILL to the process group of the started command.
+func Kill(cmd *exec.Cmd) error {
+	return signalGroup(cmd, syscall.SIGKILL)
+}
+
+func signalGroup(cmd *exec.Cmd, signal syscall.Signal) error {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		if err := syscall.Kill(-cmd.Process.Pid, signal); err != syscall.ESRCH {
+			return err
+		}
+	}
+
+	return cmd.Process.Signal(signal)
+}
@@ -0,0 +1,80 @@
+/** @type {Runtime} */
+const runtime = {
+	name: "bun",
+	pid: process.pid,
+	heapUsed() {
+		return process.memoryUsage().heapUsed
+	},
+	env(name) {
+		return Bun.env[name]
+	},
+	unsetEnv(name) {
+		delete process.env[name]
+	},
+	connect(endpoint, handlers) {
+		if (endpoint.transport === "stdio") {
+			process.stdin.setEncoding("utf8")
+			process.stdin.on("data", (data) => handlers.onData(data))
+			process.stdin.on("end", () => handlers.onClose())
+			queueMicrotask(() => handlers.onConnect())
+
+			return {
+				write(data) {
+					process.stdout.write(data)
+				},
+			}
+		}
+
+		const encoder = new TextEncoder()
+		const decoder = new TextDecoder()
+		/** @type {Uint8Array} */
+		let pending = new Uint8Array(0)
+		/** @type {any} */
+		let socket = undefined
+
+		// Bun sockets do not buffer writes, so anything that was not written
+		// is kept until the socket drains.
+		function flush() {
+			if (socket && pending.length > 0) {
+				pending = pending.subarray(socket.write(pending))
+			}
+		}
+
+		const address =
+			endpoint.transport === "unix"
+				? { unix: endpoint.path }
+				: { hostname: endpoint.hostname, port: endpoint.port }
+
+		Bun.connect({
+			...address,
+			socket: {
+				open(s) {
+					socket = s
+					handlers.onConnect()
+				},
+				data(_, data) {
+					handlers.onData(decoder.decode(data, { stream: true }))
+				},
+				drain() {
+					flush()
+				},
+				close() {
+					handlers.onClose()
+				},
+			},
+		})
+
+		return {
+			write(data) {
+				const bytes = encoder.encode(data)
+				const next = new Uint8Array(pending.length + bytes.length)
+
+				next.set(pending)
+				next.set(bytes, pending.length)
+				pending = next
+
+				flush()
+			},
+		}
+	},
+}
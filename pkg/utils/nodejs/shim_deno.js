@@ -0,0 +1,53 @@
+/** @type {Runtime} */
+const runtime = {
+	name: "deno",
+	pid: Deno.pid,
+	heapUsed() {
+		return Deno.memoryUsage().heapUsed
+	},
+	env(name) {
+		return Deno.env.get(name)
+	},
+	unsetEnv(name) {
+		Deno.env.delete(name)
+	},
+	connect(endpoint, handlers) {
+		const encoder = new TextEncoder()
+		const decoder = new TextDecoder()
+
+		/** @type {Promise<{ readable: ReadableStream<Uint8Array>, writable: WritableStream<Uint8Array> }>} */
+		let connection
+
+		if (endpoint.transport === "stdio") {
+			connection = Promise.resolve({
+				readable: Deno.stdin.readable,
+				writable: Deno.stdout.writable,
+			})
+		} else if (endpoint.transport === "unix") {
+			connection = Deno.connect({ transport: "unix", path: endpoint.path })
+		} else {
+			connection = Deno.connect({
+				hostname: endpoint.hostname,
+				port: endpoint.port,
+			})
+		}
+
+		const writer = connection.then((conn) => conn.writable.getWriter())
+
+		connection.then(async (conn) => {
+			handlers.onConnect()
+
+			for await (const chunk of conn.readable) {
+				handlers.onData(decoder.decode(chunk, { stream: true }))
+			}
+
+			handlers.onClose()
+		})
+
+		return {
+			write(data) {
+				writer.then((w) => w.write(encoder.encode(data)))
+			},
+		}
+	},
+}
@@ -0,0 +1,51 @@
+import { Socket } from "node:net"
+import process from "node:process"
+
+/** @type {Runtime} */
+const runtime = {
+	name: "node",
+	pid: process.pid,
+	heapUsed() {
+		return process.memoryUsage().heapUsed
+	},
+	env(name) {
+		return process.env[name]
+	},
+	unsetEnv(name) {
+		delete process.env[name]
+	},
+	connect(endpoint, handlers) {
+		if (endpoint.transport === "stdio") {
+			process.stdin.setEncoding("utf8")
+			process.stdin.on("data", (data) => handlers.onData(data))
+			process.stdin.on("end", () => handlers.onClose())
+			queueMicrotask(() => handlers.onConnect())
+
+			return {
+				write(data) {
+					process.stdout.write(data)
+				},
+			}
+		}
+
+		const socket = new Socket()
+
+		socket.setEncoding("utf8")
+		socket.on("data", (data) => handlers.onData(data))
+		socket.on("close", () => handlers.onClose())
+
+		if (endpoint.transport === "unix") {
+			socket.connect(endpoint.path, () => handlers.onConnect())
+		} else {
+			socket.connect(endpoint.port, endpoint.hostname, () =>
+				handlers.onConnect(),
+			)
+		}
+
+		return {
+			write(data) {
+				socket.write(data)
+			},
+		}
+	},
+}